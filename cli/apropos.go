@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/loicalleyne/cli/command"
+)
+
+// match weights, a hit in the name ranks above a hit deep in a manpage
+const (
+	scoreName     = 10
+	scoreNamePart = 6
+	scoreAlias    = 5
+	scoreHelp     = 3
+	scoreExample  = 2
+	scoreManPage  = 1
+)
+
+// aproposMatch is a command matching an apropos query
+type aproposMatch struct {
+	path  string
+	help  string
+	score int
+}
+
+// scoreCommand returns how well c matches the lower case words of a query
+func scoreCommand(c command.Command, words []string) int {
+	name := strings.ToLower(c.Name)
+	help := strings.ToLower(c.Help)
+	man := strings.ToLower(c.ManPage)
+	score := 0
+	for _, w := range words {
+		switch {
+		case name == w:
+			score += scoreName
+		case strings.Contains(name, w):
+			score += scoreNamePart
+		}
+		for _, a := range c.Aliases {
+			if strings.Contains(strings.ToLower(a), w) {
+				score += scoreAlias
+				break
+			}
+		}
+		if strings.Contains(help, w) {
+			score += scoreHelp
+		}
+		for _, e := range c.Examples {
+			if strings.Contains(strings.ToLower(e.Command+" "+e.Help), w) {
+				score += scoreExample
+				break
+			}
+		}
+		// repeated mentions in a manpage count, up to the weight of a help match
+		if n := strings.Count(man, w); n > 0 {
+			if n > scoreHelp {
+				n = scoreHelp
+			}
+			score += n * scoreManPage
+		}
+	}
+	return score
+}
+
+// apropos returns the commands of the tree matching words, best match first
+func apropos(commands []command.Command, parents []string, words []string) []aproposMatch {
+	var matches []aproposMatch
+	for _, c := range commands {
+		if c.Name == "." {
+			continue
+		}
+		path := append(append([]string{}, parents...), c.Name)
+		if score := scoreCommand(c, words); score > 0 {
+			matches = append(matches, aproposMatch{path: strings.Join(path, " "), help: c.Help, score: score})
+		}
+		matches = append(matches, apropos(c.AllSubCommands(), path, words)...)
+	}
+	return matches
+}
+
+// Apropos writes the path and help of every command whose name, aliases, help, examples or manpage
+// contain any of words to w, best match first
+func (cli *Cli) Apropos(w io.Writer, words ...string) error {
+	if len(words) == 0 {
+		return fmt.Errorf("apropos what?")
+	}
+	query := make([]string, 0, len(words))
+	for _, word := range words {
+		query = append(query, strings.ToLower(word))
+	}
+	matches := apropos(cli.commands(), nil, query)
+	if len(matches) == 0 {
+		return fmt.Errorf("%s: nothing appropriate", strings.Join(words, " "))
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+	tw := tabwriter.NewWriter(w, 0, 4, 3, ' ', 0)
+	for _, m := range matches {
+		fmt.Fprintf(tw, "%s\t%s\n", m.path, m.help)
+	}
+	return tw.Flush()
+}
@@ -3,25 +3,109 @@
 package cli
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
+	"reflect"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/chzyer/readline"
-	"github.com/fatih/color"
 	"github.com/loicalleyne/cli/command"
 	"github.com/loicalleyne/cli/vault"
 )
 
 // Cli structure contains configuration and commands
+//
+// A Cli is safe for concurrent use once built: sessions, servers, jobs and timers may dispatch commands
+// while others are added or removed. mu guards the fields below it. Writers replace the command lists
+// they change instead of modifying them, so a reader holding a snapshot of Commands, taken with mu read
+// locked, can walk it without the lock. Exported fields must not be assigned directly once the Cli is
+// shared, use AddCommand, RemoveCommand, ReplaceCommand, SetVault and the other methods instead.
+// Command funcs run without mu held and may call back into the Cli.
 type Cli struct {
+	mu              sync.RWMutex
 	Commands        []command.Command
 	ReadlineConfig  *readline.Config
 	LastInteraction time.Time
 	Scanner         *readline.Instance
 	Vault           vault.Database
+	index           CommandIndex
+	indexed         []command.Command
+	handlers        map[string]func(ctx context.Context, args []string) error
+	stdin           *readline.CancelableStdin
+	stop            context.CancelFunc
+	hooks           []*shutdownHook
+	resumed         chan struct{}
+	idleTimeout     time.Duration
+	vaultInfo       *vault.VaultInfo
+	locked          bool
+	sessions        map[*Session]struct{}
+	schedules       scheduler
+	// mounts are the Clis mounted with Mount by prefix, to refuse cycles
+	mounts map[string]*Cli
+	// busy counts the commands running in the foreground of sessions, they keep the vault from locking
+	busy int
+	// term guards the hand-off of the terminal: handoff counts the running WithTerminal funcs, interrupts
+	// receives SIGINT for Run and ignored swallows it while the terminal is handed off, interrupt cancels
+	// the command running in the foreground of the REPL, funcs counts the running commands only setting Func
+	term       sync.Mutex
+	handoff    int
+	interrupts chan os.Signal
+	ignored    chan os.Signal
+	interrupt  context.CancelFunc
+	funcs      int
+}
+
+// commands returns a snapshot of the root commands, safe to walk without holding mu
+func (cli *Cli) commands() []command.Command {
+	cli.mu.RLock()
+	defer cli.mu.RUnlock()
+	return cli.Commands
+}
+
+// CommandList returns a snapshot of the root commands, safe to walk while commands are added or removed,
+// unlike the Commands field
+func (cli *Cli) CommandList() []command.Command {
+	return cli.commands()
+}
+
+// touch records an interaction at t
+func (cli *Cli) touch(t time.Time) {
+	cli.mu.Lock()
+	cli.LastInteraction = t
+	cli.mu.Unlock()
+}
+
+// Idle returns the time elapsed since the last line was read by any session
+func (cli *Cli) Idle() time.Duration {
+	cli.mu.RLock()
+	defer cli.mu.RUnlock()
+	return time.Since(cli.LastInteraction)
+}
+
+// GetVault returns the open vault database, nil when none is open
+func (cli *Cli) GetVault() vault.Database {
+	cli.mu.RLock()
+	defer cli.mu.RUnlock()
+	return cli.Vault
+}
+
+// SetVault sets the open vault database, nil when it is closed
+func (cli *Cli) SetVault(db vault.Database) {
+	cli.mu.Lock()
+	cli.Vault = db
+	cli.mu.Unlock()
+}
+
+// scanner returns the readline instance of the process terminal
+func (cli *Cli) scanner() *readline.Instance {
+	cli.mu.RLock()
+	defer cli.mu.RUnlock()
+	return cli.Scanner
 }
 
 func filterInput(r rune) (rune, bool) {
@@ -33,17 +117,16 @@ func filterInput(r rune) (rune, bool) {
 	return r, true
 }
 
-var completer = readline.NewPrefixCompleter()
-
 // NewCli creates a new instance of Cli
 // It returns a pointer to the Cli object
 func NewCli() *Cli {
-	c := &Cli{}
+	c := &Cli{stdin: readline.NewCancelableStdin(os.Stdin)}
 
 	l, err := readline.NewEx(&readline.Config{
+		Stdin:           c.stdin,
 		Prompt:          ">>> ",
 		HistoryFile:     "/tmp/readline.tmp",
-		AutoComplete:    completer,
+		AutoComplete:    &readlineCompleter{c},
 		InterruptPrompt: "^C",
 		EOFPrompt:       "exit",
 		// TODO some weird version error broke this
@@ -58,260 +141,298 @@ func NewCli() *Cli {
 	return c
 }
 
-// AddCommand is a method on Cli takes Command as input
+// AddCommand is a method on Cli takes any ICommand as input, a Command or a custom implementation
 // This appends to the current command list to search through for input
-func (cli *Cli) AddCommand(c command.Command) {
-	cli.Commands = append(cli.Commands, c)
-
-	// recusively add command names to completer
-	pc := readline.PcItem(c.Name)
-	cli.recurseCompletion(c.SubCommands, pc, 0)
-	completer.Children = append(completer.Children, pc)
-}
-
-func (cli *Cli) peakChildren(c []command.Command, name string) *command.Command {
-	for _, cmd := range c {
-		if cmd.Name == name {
-			return &cmd
-		}
+// The whole subtree is validated first, an invalid or nil command is not added and the error is returned
+func (cli *Cli) AddCommand(i command.ICommand) error {
+	if v := reflect.ValueOf(i); !v.IsValid() || (v.Kind() == reflect.Ptr && v.IsNil()) {
+		return fmt.Errorf("cannot add a nil command")
 	}
-	return nil
+	return cli.addCommands(command.From(i))
 }
 
-func (cli *Cli) recurseCompletion(c []command.Command, pc *readline.PrefixCompleter, i int) error {
-	for _, cmd := range c {
-		p := readline.PcItem(cmd.Name)
-		pc.Children = append(pc.Children, p)
-
-		if len(cmd.SubCommands) > 0 {
-			cli.recurseCompletion(cmd.SubCommands, p, i+1)
+// addCommands validates commands against the root commands and each other and adds all of them or none
+func (cli *Cli) addCommands(commands ...command.Command) error {
+	cli.mu.Lock()
+	defer cli.mu.Unlock()
+	seen := map[string]bool{}
+	for _, r := range cli.Commands {
+		seen[r.Name] = true
+		for _, a := range r.Aliases {
+			seen[a] = true
 		}
 	}
+	if errs := validateTree(commands, nil, seen); len(errs) > 0 {
+		return errs[0]
+	}
+	// a new list, snapshots taken by readers are never modified
+	cli.Commands = append(cli.Commands[:len(cli.Commands):len(cli.Commands)], commands...)
+	cli.index = CommandIndex{}
 	return nil
 }
 
-func (cli *Cli) recurseHelp(c []command.Command, rootCommands []string, offset int) {
-	for _, cmd := range c {
-		if cmd.Name == "." {
-			continue
+func (cli *Cli) parseSystemCommands(ctx context.Context, input []string) error {
+	w := Output(ctx)
+	session := SessionFrom(ctx)
+	// --help right after the command, e.g. schedule add --help, the args of watch or set may be anything
+	if _, n := systemCommand(input); n < len(input) && wantsHelp(input[n:n+1]) {
+		return cli.Help(w, input[:n]...)
+	}
+	switch input[0] {
+	case "exit":
+		return errExit
+	case "clear":
+		fmt.Fprint(w, "\033[H\033[2J")
+	case "help":
+		return cli.Help(w, input[1:]...)
+	case "man":
+		// the pager needs the process terminal
+		if session != nil && session.remote {
+			return cli.Man(w, input[1:]...)
 		}
-		for i := 0; i < offset; i++ {
-			fmt.Printf("\t")
+		return cli.showMan(input[1:])
+	case "apropos":
+		return cli.Apropos(w, input[1:]...)
+	case "set":
+		if session == nil {
+			return fmt.Errorf("set: variables need an interactive session")
 		}
-		for _, n := range rootCommands {
-			if strings.Compare(n, cmd.Name) == 0 {
-				offset = 0
-			}
+		return session.set(input[1:])
+	case "jobs", "fg", "wait", "kill":
+		if session == nil {
+			return fmt.Errorf("%s: jobs need an interactive session", input[0])
 		}
-		fmt.Printf("[%s]: %s\n", cmd.Name, cmd.Help)
-		if len(cmd.SubCommands) > 0 {
-			cli.recurseHelp(cmd.SubCommands, rootCommands, offset+1)
+		switch input[0] {
+		case "jobs":
+			return session.listJobs()
+		case "fg":
+			return session.fg(ctx, input[1:])
+		case "wait":
+			return session.wait(ctx, input[1:])
 		}
+		return session.kill(input[1:])
+	case "watch":
+		return cli.watch(ctx, input[1:])
+	case "schedule":
+		return cli.schedule(w, input[1:])
 	}
+	return nil
 }
 
-func (cli *Cli) recurseManPage(c []command.Command, rootCommands []string, offset int) {
-	for _, cmd := range c {
-		for i := 0; i < offset; i++ {
-			fmt.Printf("\t")
-		}
-		for _, n := range rootCommands {
-			if strings.Compare(n, cmd.Name) == 0 {
-				offset = 0
-			}
-		}
-		fmt.Printf("[%s]: %s\n", cmd.Name, cmd.ManPage)
-		if len(cmd.SubCommands) > 0 {
-			cli.recurseManPage(cmd.SubCommands, rootCommands, offset+1)
-		}
+// recurse dispatches args to the deepest command of the tree they name
+func (cli *Cli) recurse(ctx context.Context, args []string) error {
+	chain, rest, err := cli.resolve(args)
+	if err != nil {
+		return err
 	}
-}
-
-func (cli *Cli) parseSystemCommands(input []string) error {
-	if input[0] == "exit" {
-		fmt.Println("Bye")
-		os.Exit(0)
+	if len(chain) == 0 {
+		return fmt.Errorf("unknown command %q, see help", args[0])
 	}
-	if input[0] == "clear" {
-		print("\033[H\033[2J")
+	cmd := chain[len(chain)-1]
+	// commands without a func print their help so users can discover subcommands
+	if !cmd.Runnable() || wantsHelp(rest) {
+		return cli.Help(Output(ctx), args[:len(chain)]...)
 	}
-	if input[0] == "help" {
-		switch i := len(input); i {
-		case 1:
-			var rootCommands []string
-			for _, r := range cli.Commands {
-				rootCommands = append(rootCommands, r.Name)
-			}
-			cli.recurseHelp(cli.Commands, rootCommands, 0)
-		default:
-			var rootCommandsNames []string
-			var rootCommands []command.Command
-			for _, cmd := range input[1:] {
-				for _, r := range cli.Commands {
-					if cmd == r.Name {
-						rootCommandsNames = append(rootCommandsNames, r.Name)
-						rootCommands = append(rootCommands, r)
-					}
-				}
-			}
-			if len(rootCommandsNames) > 0 {
-				cli.recurseHelp(rootCommands, rootCommandsNames, 0)
-			} else {
-				fmt.Println("command(s) not found")
-			}
-		}
+	if cmd.PrintsToStdout() {
+		defer cli.runFunc()()
 	}
-	if input[0] == "man" {
-		switch i := len(input); i {
-		case 1:
-			var rootCommandsNames []string
-			var rootCommands []command.Command
-			for _, r := range cli.Commands {
-				if r.ManPage != "" {
-					rootCommandsNames = append(rootCommandsNames, r.Name)
-					rootCommands = append(rootCommands, r)
-				}
-			}
-			if len(rootCommandsNames) > 0 {
-				cli.recurseManPage(rootCommands, rootCommandsNames, 0)
-			} else {
-				fmt.Println("no manpages found")
-			}
-
-		default:
-			var rootCommandsNames []string
-			var rootCommands []command.Command
-			var unfound []string
-			for _, cmd := range input[1:] {
-				for _, r := range cli.Commands {
-					if cmd == r.Name && r.ManPage != "" {
-						rootCommandsNames = append(rootCommandsNames, r.Name)
-						rootCommands = append(rootCommands, r)
-						break
-					}
-				}
-				if len(rootCommandsNames) > 0 && rootCommandsNames[len(rootCommandsNames)-1] != cmd {
-					unfound = append(unfound, cmd)
-				}
-			}
-			if len(unfound) > 0 {
-				fmt.Println("manpage not found for command(s) %v", unfound)
-			}
-			if len(rootCommandsNames) > 0 {
-				cli.recurseManPage(rootCommands, rootCommandsNames, 0)
-			} else {
-				fmt.Println("no manpages found")
-			}
-		}
-	}
-
-	return nil
+	err = cmd.Run(ctx, rest)
+	fmt.Fprintf(Output(ctx), "\n")
+	return err
 }
 
-func (cli *Cli) recurse(c []command.Command, args []string, i int) error {
-	for _, cmd := range c {
-		if i > len(args) {
-			return nil
-		}
-		if cmd.Name == args[i] {
-			if len(args) > i+1 {
-				if child := cli.peakChildren(cmd.SubCommands, args[i+1]); child != nil {
-					cli.recurse(cmd.SubCommands, args, i+1)
-				} else {
-					cmd.Func(args[i+1:])
-					fmt.Printf("\n")
-				}
-			} else {
-				cmd.Func(args[i+1:])
-				fmt.Printf("\n")
-			}
-		}
+// checkCaptured returns an error when line runs a command printing to the process stdout with Func,
+// so that callers capturing the output of line refuse it before running anything
+func (cli *Cli) checkCaptured(line string) error {
+	args := strings.Fields(line)
+	if len(args) == 0 || isSystemCommand(args[0]) {
+		return nil
+	}
+	chain, rest, err := cli.resolve(args)
+	if err != nil || len(chain) == 0 || wantsHelp(rest) {
+		// running it reports the error or shows help
+		return nil
+	}
+	if c := chain[len(chain)-1]; c.PrintsToStdout() {
+		return fmt.Errorf("%s: %w", strings.Join(args[:len(chain)], " "), command.ErrStdout)
 	}
 	return nil
 }
 
-func (cli *Cli) findCommand(input string) error {
+func (cli *Cli) findCommand(ctx context.Context, input string) error {
 	parsed := strings.Fields(input)
 	if len(parsed) == 0 {
-		fmt.Println("No input detected")
+		fmt.Fprintln(Output(ctx), "No input detected")
 		return nil
 	}
-	if systemCmd := cli.parseSystemCommands(parsed); systemCmd != nil {
-		return nil
+	if isSystemCommand(parsed[0]) {
+		return cli.parseSystemCommands(ctx, parsed)
 	}
-	currentCommands := cli.Commands
-	error := cli.recurse(currentCommands, parsed, 0)
+	error := cli.recurse(ctx, parsed)
 	if error != nil {
 		return error
 	}
 	return nil
 }
 
-func (cli *Cli) readline() string {
-	text, _ := cli.Scanner.Readline()
-	cli.Scanner.SaveHistory(text)
-	return text
-}
-
 // Run is the primary entrypoint to start blocking and reading user input
-func (cli *Cli) Run() {
-	if len(os.Args) > 1 && os.Args[1] == "unattended" {
-		err := cli.findCommand(strings.Join(os.Args[2:], " "))
-		if err != nil {
-			color.Red(err.Error())
+// It returns when the user exits, input ends, ctx is cancelled, Stop is called or the process receives
+// SIGTERM, after running the shutdown hooks registered with OnShutdown on every one of those paths.
+// In the REPL SIGINT cancels the context of the command running in the foreground, if any, and the REPL
+// prompts again. When the first program arg is __complete, __tools or unattended, that mode runs instead
+// of the REPL and its error, e.g. the error of the unattended command, is returned. SIGINT stops these modes
+// like SIGTERM: it cancels the context of the unattended command or of the tool call running, and the tool
+// server stops reading stdin. A command only setting Func has no context to cancel: while one runs, SIGINT
+// runs the shutdown hooks and exits the process with status 130, in every mode.
+func (cli *Cli) Run(ctx context.Context) (err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	cli.mu.Lock()
+	cli.stop = cancel
+	cli.mu.Unlock()
+	defer func() {
+		cli.mu.Lock()
+		cli.stop = nil
+		cli.mu.Unlock()
+		if hookErr := cli.shutdown(); err == nil {
+			err = hookErr
 		}
-		os.Exit(0)
-	}
+	}()
 
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
+	interrupts, terms := make(chan os.Signal, 1), make(chan os.Signal, 1)
+	signal.Notify(terms, syscall.SIGTERM)
+	defer signal.Stop(terms)
+	cli.term.Lock()
+	signal.Notify(interrupts, os.Interrupt)
+	cli.interrupts = interrupts
+	cli.term.Unlock()
+	defer func() {
+		cli.term.Lock()
+		signal.Stop(interrupts)
+		cli.interrupts = nil
+		cli.term.Unlock()
+	}()
+	mode := ""
+	if len(os.Args) > 1 {
+		mode = os.Args[1]
+	}
+	repl := mode != completeCommand && mode != toolsCommand && mode != "unattended"
 	go func() {
-		for range c {
-			fmt.Printf("\nBye\n")
-			os.Exit(0)
+		for {
+			select {
+			case <-interrupts:
+				cli.interruptFunc()
+				if repl {
+					cli.interruptCommand()
+					continue
+				}
+			case <-terms:
+			case <-ctx.Done():
+				return
+			}
+			cancel()
+			return
 		}
 	}()
 
-	for {
-		// Get user input
-		fmt.Print(cli.Scanner.Config.Prompt)
-
-		text := cli.readline()
-		cli.LastInteraction = time.Now()
-
-		err := cli.findCommand(text)
-		if err != nil {
-			color.Red(err.Error())
+	if !repl {
+		switch mode {
+		case completeCommand:
+			for _, c := range cli.Complete(os.Args[2:]) {
+				fmt.Println(c)
+			}
+			return nil
+		case toolsCommand:
+			return cli.ServeTools(ctx, os.Stdin, os.Stdout, os.Args[2:]...)
+		case "unattended":
+			err := cli.findCommand(ctx, strings.Join(os.Args[2:], " "))
+			if err == errExit {
+				return nil
+			}
+			return err
 		}
 	}
+	return cli.repl(ctx)
 }
 
-func (cli *Cli) Suspend() {
-	cli.ReadlineConfig = cli.Scanner.Config.Clone()
-	cli.Scanner.Config.Stdin.Close()
-	cli.Scanner.Operation.Close()
-	cli.Scanner.Terminal.Close()
-	t := new(time.Time)
-	cli.LastInteraction = *t
+// repl runs the session on the process terminal until it ends
+func (cli *Cli) repl(ctx context.Context) error {
+	scanner := cli.scanner()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// Readline blocks reading stdin, ending its input is the only way to interrupt it
+			cli.stdin.Close()
+		case <-done:
+		}
+	}()
+	// the idle timeout counts from the start of the REPL
+	cli.touch(time.Now())
+	go cli.watchIdle(ctx)
+	go cli.RunSchedules(ctx, nil)
+	err := cli.localSession().Run(ctx)
+	scanner.Close()
+	fmt.Println("Bye")
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
 }
 
-func (cli *Cli) Resume() {
-	l, err := readline.NewEx(cli.ReadlineConfig)
-	if err != nil {
-		panic(err)
+// Stop makes a running Run return as if its context was cancelled
+// It is safe to call from any goroutine, e.g. a command, and does nothing when Run is not running
+func (cli *Cli) Stop() {
+	cli.mu.RLock()
+	stop := cli.stop
+	cli.mu.RUnlock()
+	if stop != nil {
+		stop()
 	}
-	cli.Scanner = l
-	cli.LastInteraction = time.Now()
-	for {
-		// Get user input
-		fmt.Print(cli.Scanner.Config.Prompt)
+}
 
-		text := cli.readline()
-		cli.LastInteraction = time.Now()
+// shutdownHook is a hook registered with OnShutdown, a pointer so that it can be removed
+type shutdownHook struct {
+	run func() error
+}
+
+// OnShutdown registers hook to run when Run returns, e.g. to close the vault
+// Hooks run once, in reverse order of registration, and the first error is returned by Run
+func (cli *Cli) OnShutdown(hook func() error) {
+	cli.onShutdown(hook)
+}
+
+// onShutdown registers hook like OnShutdown and returns the func removing it, for hooks only needed
+// while something runs, e.g. a server
+func (cli *Cli) onShutdown(hook func() error) func() {
+	h := &shutdownHook{run: hook}
+	cli.mu.Lock()
+	cli.hooks = append(cli.hooks, h)
+	cli.mu.Unlock()
+	return func() {
+		cli.mu.Lock()
+		defer cli.mu.Unlock()
+		for i, o := range cli.hooks {
+			if o == h {
+				cli.hooks = append(cli.hooks[:i:i], cli.hooks[i+1:]...)
+				return
+			}
+		}
+	}
+}
 
-		err := cli.findCommand(text)
-		if err != nil {
-			color.Red(err.Error())
+// shutdown runs and forgets the shutdown hooks
+func (cli *Cli) shutdown() error {
+	cli.mu.Lock()
+	hooks := cli.hooks
+	cli.hooks = nil
+	cli.mu.Unlock()
+	var first error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if err := hooks[i].run(); err != nil && first == nil {
+			first = err
 		}
 	}
+	return first
 }
@@ -1,9 +1,15 @@
 package cli
 
-import "github.com/loicalleyne/cli/command"
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/loicalleyne/cli/command"
+)
 
 func CreateCommandMap(cli *Cli) map[string]func(args []string) {
-	m := commandsToMap(cli.Commands, "")
+	m := commandsToMap(cli.commands(), "")
 	return m
 }
 
@@ -11,12 +17,12 @@ func commandsToMap(commands []command.Command, prefix string) map[string]func(ar
 	commandMap := make(map[string]func(args []string))
 	for _, command := range commands {
 		key := prefix + command.Name
-		cmdFunc := command.Func
+		c := command
 		commandMap[key] = func(args []string) {
-			cmdFunc(args)
+			c.Run(context.Background(), args)
 		}
-		if len(command.SubCommands) > 0 {
-			nestedCommandMap := commandsToMap(command.SubCommands, key+".")
+		if subs := command.AllSubCommands(); len(subs) > 0 {
+			nestedCommandMap := commandsToMap(subs, key+".")
 			commandMap = mergeMaps(commandMap, nestedCommandMap)
 		}
 	}
@@ -33,3 +39,137 @@ func mergeMaps(map1, map2 map[string]func(args []string)) map[string]func(args [
 	}
 	return result
 }
+
+// CommandIndex maps the dotted path of every command of a tree to the command, e.g. "github.login"
+// Aliases are lookups to the canonical path, so "gh.login" finds the same command without the subtree
+// being indexed once per alias. Subcommands supplied by Dynamic are not indexed, they are resolved from
+// their parent when looked up
+type CommandIndex struct {
+	commands map[string]command.Command
+	// aliases maps the canonical path of a parent joined with an alias to the canonical path of the command
+	aliases map[string]string
+}
+
+// CreateCommandIndex returns the index of the commands of cli
+func CreateCommandIndex(cli *Cli) CommandIndex {
+	return newCommandIndex(cli.commands())
+}
+
+func newCommandIndex(commands []command.Command) CommandIndex {
+	index := CommandIndex{commands: map[string]command.Command{}, aliases: map[string]string{}}
+	index.add(commands, "")
+	return index
+}
+
+func (index CommandIndex) add(commands []command.Command, prefix string) {
+	for _, c := range commands {
+		path := prefix + c.Name
+		index.commands[path] = c
+		for _, alias := range c.Aliases {
+			index.aliases[prefix+alias] = path
+		}
+		index.add(c.SubCommands, path+".")
+	}
+}
+
+// Get returns the command at the dotted path, whose words may be aliases, e.g. "gh.login"
+func (index CommandIndex) Get(path string) (command.Command, bool) {
+	chain, rest := index.Resolve(strings.Split(path, "."))
+	if len(chain) == 0 || len(rest) > 0 {
+		return command.Command{}, false
+	}
+	return chain[len(chain)-1], true
+}
+
+// Resolve walks path, command names or aliases from the root, one lookup per level
+// It returns the chain of matched commands and the words left once no subcommand matches
+// The walk stops at a dynamic command whose subcommands are invalid
+func (index CommandIndex) Resolve(path []string) ([]command.Command, []string) {
+	chain, rest, _ := index.resolve(path)
+	return chain, rest
+}
+
+func (index CommandIndex) resolve(path []string) ([]command.Command, []string, error) {
+	var chain []command.Command
+	canonical := ""
+	for i, name := range path {
+		key := name
+		if i > 0 {
+			key = canonical + "." + name
+		}
+		if target, ok := index.aliases[key]; ok {
+			key = target
+		}
+		c, ok := index.commands[key]
+		if !ok {
+			if i == 0 || chain[i-1].Dynamic == nil {
+				return chain, path[i:], nil
+			}
+			// below a dynamic command the rest of the tree is only known to its parents
+			return resolveDynamic(chain, path[i:])
+		}
+		chain = append(chain, c)
+		canonical = key
+	}
+	return chain, nil, nil
+}
+
+// resolveDynamic continues the walk of chain along path through the subcommands of the last command
+// Subcommands returned by Dynamic are validated like registered ones before being matched
+func resolveDynamic(chain []command.Command, path []string) ([]command.Command, []string, error) {
+	for i, name := range path {
+		last := chain[len(chain)-1]
+		subs := last.AllSubCommands()
+		if last.Dynamic != nil {
+			if errs := validateTree(subs, chainNames(chain), map[string]bool{}); len(errs) > 0 {
+				return chain, path[i:], errs[0]
+			}
+		}
+		var next *command.Command
+		for _, s := range subs {
+			if s.HasName(name) {
+				s := s
+				next = &s
+				break
+			}
+		}
+		if next == nil {
+			return chain, path[i:], nil
+		}
+		chain = append(chain, *next)
+	}
+	return chain, nil, nil
+}
+
+// commandIndex returns the index of the commands, rebuilt when the root commands changed since it was
+// last built. AddCommand, RemoveCommand and ReplaceCommand reset it, changes made to nested
+// SubCommands by hand should go through them
+// The index is never modified once built and can be used without holding mu
+func (cli *Cli) commandIndex() CommandIndex {
+	cli.mu.Lock()
+	defer cli.mu.Unlock()
+	if cli.index.commands == nil || len(cli.indexed) != len(cli.Commands) ||
+		(len(cli.Commands) > 0 && &cli.indexed[0] != &cli.Commands[0]) {
+		cli.index = newCommandIndex(cli.Commands)
+		cli.indexed = cli.Commands
+	}
+	return cli.index
+}
+
+// Lookup returns the command at the dotted path, e.g. "github.login"
+func (cli *Cli) Lookup(path string) (command.Command, bool) {
+	return cli.commandIndex().Get(path)
+}
+
+// Invoke runs the command at the dotted path with args, as if typed after the command path
+// A command with nothing to run writes its help to Output(ctx)
+func (cli *Cli) Invoke(ctx context.Context, path string, args []string) error {
+	c, ok := cli.Lookup(path)
+	if !ok {
+		return fmt.Errorf("unknown command %q", path)
+	}
+	if !c.Runnable() {
+		return cli.Help(Output(ctx), strings.Split(path, ".")...)
+	}
+	return c.Run(ctx, args)
+}
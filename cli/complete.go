@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/loicalleyne/cli/command"
+)
+
+// completeCommand is the hidden first argument used by the generated shell scripts
+// to ask the binary for completion candidates, e.g. myapp __complete github lo
+const completeCommand = "__complete"
+
+// Complete returns the completion candidates for the last of words
+// words are the words typed so far, the last one is the word being completed and may be empty
+// Candidates are subcommand names and aliases, flags when the word starts with a dash and the
+// results of the Complete func of the command
+func (cli *Cli) Complete(words []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	// help and man take a command path
+	if len(words) > 1 && (words[0] == "help" || words[0] == "man") {
+		return cli.complete(words[1:], false)
+	}
+	return cli.complete(words, true)
+}
+
+// complete returns the candidates for the last of words, system commands are candidates for the first word when system is set
+func (cli *Cli) complete(words []string, system bool) []string {
+	partial := words[len(words)-1]
+	chain, rest, _ := cli.resolve(words[:len(words)-1])
+
+	var candidates []string
+	if len(chain) == 0 {
+		if len(rest) > 0 {
+			return nil
+		}
+		candidates = append(candidates, names(cli.commands())...)
+		if system {
+			candidates = append(candidates, names(systemCommands)...)
+		}
+	} else {
+		c := chain[len(chain)-1]
+		if strings.HasPrefix(partial, "-") {
+			candidates = append(candidates, flagNames(c)...)
+		} else {
+			if len(rest) == 0 {
+				candidates = append(candidates, names(c.AllSubCommands())...)
+			}
+			if c.Complete != nil {
+				candidates = append(candidates, c.Complete(append(append([]string{}, rest...), partial))...)
+			}
+		}
+	}
+
+	var matches []string
+	seen := map[string]bool{}
+	for _, c := range candidates {
+		if strings.HasPrefix(c, partial) && !seen[c] {
+			seen[c] = true
+			matches = append(matches, c)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// names returns the names and aliases of commands
+func names(commands []command.Command) []string {
+	var n []string
+	for _, c := range commands {
+		if c.Name == "." {
+			continue
+		}
+		n = append(n, c.Name)
+		n = append(n, c.Aliases...)
+	}
+	return n
+}
+
+// flagNames returns the long and short forms of the flags of c, plus --help
+func flagNames(c command.Command) []string {
+	var n []string
+	for _, f := range c.Flags {
+		n = append(n, "--"+f.Name)
+		if f.Short != "" {
+			n = append(n, "-"+f.Short)
+		}
+	}
+	return append(n, "--help")
+}
+
+// readlineCompleter adapts Cli.Complete to the readline.AutoCompleter interface
+type readlineCompleter struct {
+	cli *Cli
+}
+
+func (r *readlineCompleter) Do(line []rune, pos int) ([][]rune, int) {
+	typed := string(line[:pos])
+	words := strings.Fields(typed)
+	if len(words) == 0 || strings.HasSuffix(typed, " ") {
+		words = append(words, "")
+	}
+	partial := words[len(words)-1]
+
+	var candidates [][]rune
+	for _, c := range r.cli.Complete(words) {
+		candidates = append(candidates, []rune(strings.TrimPrefix(c, partial)+" "))
+	}
+	return candidates, len([]rune(partial))
+}
@@ -0,0 +1,288 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/loicalleyne/cli/command"
+)
+
+// completionNode is a command of the tree as seen by the generated completion scripts
+type completionNode struct {
+	// key is the space separated path of the command, empty for the root
+	key      string
+	children []command.Command
+	flags    []command.Flag
+	dynamic  bool
+}
+
+func (cli *Cli) completionNodes() []completionNode {
+	commands := cli.commands()
+	root := completionNode{children: append(append([]command.Command{}, commands...), systemCommands...)}
+	nodes := []completionNode{root}
+	var walk func(commands []command.Command, parents []string)
+	walk = func(commands []command.Command, parents []string) {
+		for _, c := range commands {
+			if c.Name == "." {
+				continue
+			}
+			path := append(append([]string{}, parents...), c.Name)
+			subs := c.AllSubCommands()
+			nodes = append(nodes, completionNode{
+				key:      strings.Join(path, " "),
+				children: subs,
+				flags:    c.Flags,
+				dynamic:  c.Complete != nil || c.Dynamic != nil,
+			})
+			walk(subs, path)
+		}
+	}
+	walk(commands, nil)
+	return nodes
+}
+
+// childKey returns the key of the child of n named name
+func (n completionNode) childKey(c command.Command) string {
+	return strings.TrimSpace(n.key + " " + c.Name)
+}
+
+var nonIdentifier = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// shQuote single quotes s for bash and zsh
+func shQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// fishQuote single quotes s for fish
+func fishQuote(s string) string {
+	return "'" + strings.Replace(strings.Replace(s, `\`, `\\`, -1), "'", `\'`, -1) + "'"
+}
+
+// firstLine returns the first line of s for use as a completion description
+func firstLine(s string) string {
+	return strings.TrimSpace(strings.SplitN(s, "\n", 2)[0])
+}
+
+// writeCaseChild writes the shell function mapping "<key>|<word>" to the key of the child named word
+func writeCaseChild(b *strings.Builder, fn string, nodes []completionNode) {
+	fmt.Fprintf(b, "__%s_child() {\n    case \"$1\" in\n", fn)
+	for _, n := range nodes {
+		for _, c := range n.children {
+			var patterns []string
+			for _, name := range append([]string{c.Name}, c.Aliases...) {
+				patterns = append(patterns, shQuote(n.key+"|"+name))
+			}
+			fmt.Fprintf(b, "        %s) echo %s ;;\n", strings.Join(patterns, "|"), shQuote(n.childKey(c)))
+		}
+	}
+	fmt.Fprintf(b, "    esac\n}\n\n")
+}
+
+func writeCaseDynamic(b *strings.Builder, fn string, nodes []completionNode) {
+	fmt.Fprintf(b, "__%s_dynamic() {\n    case \"$1\" in\n", fn)
+	for _, n := range nodes {
+		if n.dynamic {
+			fmt.Fprintf(b, "        %s) return 0 ;;\n", shQuote(n.key))
+		}
+	}
+	fmt.Fprintf(b, "    esac\n    return 1\n}\n\n")
+}
+
+// GenBashCompletion writes a bash completion script for the binary prog to w
+// Commands with a Complete or Dynamic func are completed by calling prog __complete
+func (cli *Cli) GenBashCompletion(w io.Writer, prog string) error {
+	fn := nonIdentifier.ReplaceAllString(prog, "_")
+	nodes := cli.completionNodes()
+	b := &strings.Builder{}
+
+	fmt.Fprintf(b, "# bash completion for %s, generated from its command tree\n\n", prog)
+	writeCaseChild(b, fn, nodes)
+	fmt.Fprintf(b, "__%s_words() {\n    case \"$1\" in\n", fn)
+	for _, n := range nodes {
+		if words := names(n.children); len(words) > 0 {
+			fmt.Fprintf(b, "        %s) echo %s ;;\n", shQuote(n.key), shQuote(strings.Join(words, " ")))
+		}
+	}
+	fmt.Fprintf(b, "    esac\n}\n\n")
+	fmt.Fprintf(b, "__%s_flags() {\n    case \"$1\" in\n        '') ;;\n", fn)
+	for _, n := range nodes[1:] {
+		fmt.Fprintf(b, "        %s) echo %s ;;\n", shQuote(n.key), shQuote(strings.Join(flagNames(command.Command{Flags: n.flags}), " ")))
+	}
+	fmt.Fprintf(b, "    esac\n}\n\n")
+	writeCaseDynamic(b, fn, nodes)
+	fmt.Fprintf(b, `_%[1]s() {
+    local cur="${COMP_WORDS[COMP_CWORD]}" key="" next start=1 i
+    [[ "${COMP_WORDS[start]}" == unattended && COMP_CWORD -gt start ]] && ((start++))
+    [[ ( "${COMP_WORDS[start]}" == help || "${COMP_WORDS[start]}" == man ) && COMP_CWORD -gt start ]] && ((start++))
+    for ((i = start; i < COMP_CWORD; i++)); do
+        next="$(__%[1]s_child "${key}|${COMP_WORDS[i]}")"
+        [[ -z "$next" ]] && break
+        key="$next"
+    done
+    if [[ "$cur" == -* ]]; then
+        COMPREPLY=($(compgen -W "$(__%[1]s_flags "$key")" -- "$cur"))
+    elif __%[1]s_dynamic "$key"; then
+        COMPREPLY=($("${COMP_WORDS[0]}" %[3]s "${COMP_WORDS[@]:start:COMP_CWORD-start+1}" 2>/dev/null))
+    else
+        COMPREPLY=($(compgen -W "$(__%[1]s_words "$key")" -- "$cur"))
+    fi
+}
+
+complete -F _%[1]s %[2]s
+`, fn, prog, completeCommand)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// zshDescribe formats name and help as a _describe item
+func zshDescribe(name, help string) string {
+	return shQuote(strings.Replace(name, ":", `\:`, -1) + ":" + firstLine(help))
+}
+
+// GenZshCompletion writes a zsh completion script for the binary prog to w
+// Commands with a Complete or Dynamic func are completed by calling prog __complete
+func (cli *Cli) GenZshCompletion(w io.Writer, prog string) error {
+	fn := nonIdentifier.ReplaceAllString(prog, "_")
+	nodes := cli.completionNodes()
+	b := &strings.Builder{}
+
+	fmt.Fprintf(b, "#compdef %s\n# zsh completion for %s, generated from its command tree\n\n", prog, prog)
+	writeCaseChild(b, fn, nodes)
+	fmt.Fprintf(b, "__%s_words() {\n    case \"$1\" in\n", fn)
+	for _, n := range nodes {
+		var items []string
+		for _, c := range n.children {
+			if c.Name == "." {
+				continue
+			}
+			for _, name := range append([]string{c.Name}, c.Aliases...) {
+				items = append(items, zshDescribe(name, c.Help))
+			}
+		}
+		if len(items) > 0 {
+			fmt.Fprintf(b, "        %s) print -rl -- %s ;;\n", shQuote(n.key), strings.Join(items, " "))
+		}
+	}
+	fmt.Fprintf(b, "    esac\n}\n\n")
+	fmt.Fprintf(b, "__%s_flags() {\n    case \"$1\" in\n        '') ;;\n", fn)
+	for _, n := range nodes[1:] {
+		var items []string
+		for _, f := range n.flags {
+			items = append(items, zshDescribe("--"+f.Name, f.Help))
+			if f.Short != "" {
+				items = append(items, zshDescribe("-"+f.Short, f.Help))
+			}
+		}
+		items = append(items, zshDescribe("--help", "show help"))
+		fmt.Fprintf(b, "        %s) print -rl -- %s ;;\n", shQuote(n.key), strings.Join(items, " "))
+	}
+	fmt.Fprintf(b, "    esac\n}\n\n")
+	writeCaseDynamic(b, fn, nodes)
+	fmt.Fprintf(b, `_%[1]s() {
+    local key="" next start=2 i
+    local -a candidates
+    [[ "${words[start]}" == unattended && CURRENT -gt start ]] && ((start++))
+    [[ ( "${words[start]}" == help || "${words[start]}" == man ) && CURRENT -gt start ]] && ((start++))
+    for ((i = start; i < CURRENT; i++)); do
+        next="$(__%[1]s_child "${key}|${words[i]}")"
+        [[ -z "$next" ]] && break
+        key="$next"
+    done
+    if [[ "${words[CURRENT]}" == -* ]]; then
+        candidates=(${(f)"$(__%[1]s_flags "$key")"})
+        _describe -t flags 'flag' candidates
+    elif __%[1]s_dynamic "$key"; then
+        candidates=(${(f)"$(${words[1]} %[3]s "${(@)words[start,CURRENT]}" 2>/dev/null)"})
+        compadd -a candidates
+    else
+        candidates=(${(f)"$(__%[1]s_words "$key")"})
+        _describe -t commands 'command' candidates
+    fi
+}
+
+compdef _%[1]s %[2]s
+`, fn, prog, completeCommand)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// GenFishCompletion writes a fish completion script for the binary prog to w
+// Commands with a Complete or Dynamic func are completed by calling prog __complete
+func (cli *Cli) GenFishCompletion(w io.Writer, prog string) error {
+	fn := nonIdentifier.ReplaceAllString(prog, "_")
+	nodes := cli.completionNodes()
+	b := &strings.Builder{}
+
+	fmt.Fprintf(b, "# fish completion for %s, generated from its command tree\n\n", prog)
+	// keys are prefixed with a slash so the root key is never empty
+	fmt.Fprintf(b, `function __%[1]s_args
+    set -l tokens (commandline -opc)
+    set -e tokens[1]
+    if test "$tokens[1]" = unattended
+        set -e tokens[1]
+    end
+    if contains -- "$tokens[1]" help man
+        set -e tokens[1]
+    end
+    printf '%%s\n' $tokens
+end
+
+function __%[1]s_key
+    set -l key /
+    for t in (__%[1]s_args)
+        set -l next (__%[1]s_child "$key|$t")
+        test -z "$next"; and break
+        set key $next
+    end
+    echo $key
+end
+
+function __%[1]s_complete
+    set -l current (commandline -ct)
+    %[2]s %[3]s (__%[1]s_args) "$current"
+end
+
+function __%[1]s_child
+    switch $argv[1]
+`, fn, prog, completeCommand)
+	for _, n := range nodes {
+		for _, c := range n.children {
+			var patterns []string
+			for _, name := range append([]string{c.Name}, c.Aliases...) {
+				patterns = append(patterns, fishQuote("/"+n.key+"|"+name))
+			}
+			fmt.Fprintf(b, "        case %s\n            echo %s\n", strings.Join(patterns, " "), fishQuote("/"+n.childKey(c)))
+		}
+	}
+	fmt.Fprintf(b, "    end\nend\n\ncomplete -c %s -f\n", prog)
+	for _, n := range nodes {
+		cond := fishQuote(fmt.Sprintf("test (__%s_key) = %s", fn, fishQuote("/"+n.key)))
+		for _, c := range n.children {
+			if c.Name == "." {
+				continue
+			}
+			for _, name := range append([]string{c.Name}, c.Aliases...) {
+				fmt.Fprintf(b, "complete -c %s -n %s -a %s -d %s\n", prog, cond, fishQuote(name), fishQuote(firstLine(c.Help)))
+			}
+		}
+		for _, f := range n.flags {
+			short := ""
+			if len(f.Short) == 1 {
+				short = " -s " + fishQuote(f.Short)
+			} else if f.Short != "" {
+				short = " -o " + fishQuote(f.Short)
+			}
+			fmt.Fprintf(b, "complete -c %s -n %s -l %s%s -d %s\n", prog, cond, fishQuote(f.Name), short, fishQuote(firstLine(f.Help)))
+		}
+		if n.dynamic {
+			fmt.Fprintf(b, "complete -c %s -n %s -a %s\n", prog, cond, fishQuote(fmt.Sprintf("(__%s_complete)", fn)))
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
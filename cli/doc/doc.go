@@ -0,0 +1,35 @@
+// Package doc generates documentation for a cli.Cli command tree
+// It writes one Markdown file per command, section 1 roff man pages and a static HTML index
+// from the same command.Command definitions the Cli dispatches on.
+package doc
+
+import (
+	"strings"
+
+	"github.com/loicalleyne/cli/command"
+)
+
+// walk calls fn for every command of the tree depth first, parents are the names above the command
+func walk(commands []command.Command, parents []string, fn func(c command.Command, parents []string) error) error {
+	for _, c := range commands {
+		if c.Name == "." {
+			continue
+		}
+		if err := fn(c, parents); err != nil {
+			return err
+		}
+		if err := walk(c.AllSubCommands(), append(append([]string{}, parents...), c.Name), fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func path(c command.Command, parents []string) string {
+	return strings.Join(append(append([]string{}, parents...), c.Name), " ")
+}
+
+// basename returns the file name, without extension, used for the docs of a command
+func basename(c command.Command, parents []string, sep string) string {
+	return strings.Join(append(append([]string{}, parents...), c.Name), sep)
+}
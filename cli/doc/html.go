@@ -0,0 +1,121 @@
+package doc
+
+import (
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/loicalleyne/cli/cli"
+	"github.com/loicalleyne/cli/command"
+)
+
+// htmlCommand is a command flattened for the HTML index template
+type htmlCommand struct {
+	command.Command
+	Path   string
+	Anchor string
+	Depth  int
+}
+
+var htmlIndex = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; max-width: 960px; margin: 2em auto; padding: 0 1em; color: #222; }
+nav li { list-style: none; }
+pre { background: #f4f4f4; padding: .5em 1em; overflow-x: auto; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ddd; padding: .25em .75em; text-align: left; vertical-align: top; }
+section { border-top: 1px solid #ddd; margin-top: 2em; }
+.help { color: #555; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<nav><ul>
+{{- range .Commands}}
+<li style="margin-left: {{.Depth}}em"><a href="#{{.Anchor}}">{{.Path}}</a> <span class="help">{{.Help}}</span></li>
+{{- end}}
+</ul></nav>
+{{- range .Commands}}
+<section id="{{.Anchor}}">
+<h2>{{.Path}}</h2>
+{{- if .Help}}
+<p class="help">{{.Help}}</p>
+{{- end}}
+<h3>Usage</h3>
+<pre>{{.UsageLine .Path}}</pre>
+{{- if .Aliases}}
+<h3>Aliases</h3>
+<p>{{range $i, $a := .Aliases}}{{if $i}}, {{end}}<code>{{$a}}</code>{{end}}</p>
+{{- end}}
+{{- if .Args}}
+<h3>Arguments</h3>
+<table>
+{{- range .Args}}
+<tr><td><code>{{.Synopsis}}</code></td><td>{{.Help}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- if .Flags}}
+<h3>Flags</h3>
+<table>
+<tr><th>Flag</th><th>Default</th><th>Description</th></tr>
+{{- range .Flags}}
+<tr><td><code>{{.Synopsis}}</code></td><td>{{if .Default}}<code>{{.Default}}</code>{{end}}</td><td>{{.Help}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- if .Examples}}
+<h3>Examples</h3>
+{{- range .Examples}}
+{{- if .Help}}
+<p>{{.Help}}</p>
+{{- end}}
+<pre>{{.Command}}</pre>
+{{- end}}
+{{- end}}
+{{- if .ManPage}}
+<h3>Description</h3>
+<pre>{{.ManPage}}</pre>
+{{- end}}
+</section>
+{{- end}}
+</body>
+</html>
+`))
+
+// GenHTMLIndex writes a static HTML page documenting every command of c to w
+// title is used as the page title
+func GenHTMLIndex(c *cli.Cli, title string, w io.Writer) error {
+	var flat []htmlCommand
+	err := walk(c.CommandList(), nil, func(cmd command.Command, parents []string) error {
+		flat = append(flat, htmlCommand{
+			Command: cmd,
+			Path:    path(cmd, parents),
+			Anchor:  basename(cmd, parents, "-"),
+			Depth:   len(parents),
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return htmlIndex.Execute(w, struct {
+		Title    string
+		Commands []htmlCommand
+	}{title, flat})
+}
+
+// GenHTMLTree writes the HTML index of c to dir/index.html
+func GenHTMLTree(c *cli.Cli, title string, dir string) error {
+	f, err := os.Create(filepath.Join(dir, "index.html"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return GenHTMLIndex(c, title, f)
+}
@@ -0,0 +1,221 @@
+package doc
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/loicalleyne/cli/cli"
+	"github.com/loicalleyne/cli/command"
+)
+
+// ManHeader holds the fields of the .TH line of generated man pages
+type ManHeader struct {
+	// Section defaults to 1
+	Section string
+	// Date defaults to the current date
+	Date *time.Time
+	// Source is the name and version of the program, e.g. "myapp 1.2.0"
+	Source string
+	// Manual is the title of the manual, e.g. "MyApp Manual"
+	Manual string
+}
+
+// GenManTree writes one roff man page per command of c into dir, e.g. dir/github-login.1
+func GenManTree(c *cli.Cli, header *ManHeader, dir string) error {
+	if header == nil {
+		header = &ManHeader{}
+	}
+	return walk(c.CommandList(), nil, func(cmd command.Command, parents []string) error {
+		section := header.Section
+		if section == "" {
+			section = "1"
+		}
+		f, err := os.Create(filepath.Join(dir, basename(cmd, parents, "-")+"."+section))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return GenMan(cmd, parents, header, f)
+	})
+}
+
+// GenMan writes the roff man page of cmd to w, parents are the names of the commands above it
+func GenMan(cmd command.Command, parents []string, header *ManHeader, w io.Writer) error {
+	if header == nil {
+		header = &ManHeader{}
+	}
+	section := header.Section
+	if section == "" {
+		section = "1"
+	}
+	date := time.Now()
+	if header.Date != nil {
+		date = *header.Date
+	}
+	p := path(cmd, parents)
+	title := strings.ToUpper(basename(cmd, parents, "-"))
+
+	b := &strings.Builder{}
+	fmt.Fprintf(b, ".TH \"%s\" \"%s\" \"%s\" \"%s\" \"%s\"\n", title, section, date.Format("Jan 2006"), roffEscape(header.Source), roffEscape(header.Manual))
+	fmt.Fprintf(b, ".SH NAME\n%s", roffEscape(basename(cmd, parents, "-")))
+	if cmd.Help != "" {
+		fmt.Fprintf(b, " \\- %s", roffEscape(cmd.Help))
+	}
+	fmt.Fprintf(b, "\n.SH SYNOPSIS\n\\fB%s\\fP\n", roffEscape(cmd.UsageLine(p)))
+	if md := strings.TrimSpace(cmd.ManPage); md != "" {
+		// manpages starting with their own top level section keep it
+		if !strings.HasPrefix(md, "# ") {
+			fmt.Fprintf(b, ".SH DESCRIPTION\n")
+		}
+		fmt.Fprintf(b, "%s", markdownToRoff(md))
+	} else if cmd.Help != "" {
+		fmt.Fprintf(b, ".SH DESCRIPTION\n%s\n", roffEscape(cmd.Help))
+	}
+	if len(cmd.Aliases) > 0 {
+		fmt.Fprintf(b, ".SH ALIASES\n%s\n", roffEscape(strings.Join(cmd.Aliases, ", ")))
+	}
+	if len(cmd.Args) > 0 {
+		fmt.Fprintf(b, ".SH ARGUMENTS\n")
+		for _, a := range cmd.Args {
+			fmt.Fprintf(b, ".TP\n\\fI%s\\fP\n", roffEscape(a.Synopsis()))
+			if a.Help != "" {
+				fmt.Fprintf(b, "%s\n", roffEscape(a.Help))
+			}
+		}
+	}
+	if len(cmd.Flags) > 0 {
+		fmt.Fprintf(b, ".SH OPTIONS\n")
+		for _, f := range cmd.Flags {
+			help := f.Help
+			if f.Default != "" {
+				help += fmt.Sprintf(" (default %q)", f.Default)
+			}
+			fmt.Fprintf(b, ".TP\n\\fB%s\\fP\n", roffEscape(strings.TrimSpace(f.Synopsis())))
+			if help != "" {
+				fmt.Fprintf(b, "%s\n", roffEscape(help))
+			}
+		}
+	}
+	if len(cmd.Examples) > 0 {
+		fmt.Fprintf(b, ".SH EXAMPLES\n")
+		for _, e := range cmd.Examples {
+			if e.Help != "" {
+				fmt.Fprintf(b, ".PP\n%s\n", roffEscape(e.Help))
+			}
+			fmt.Fprintf(b, ".PP\n.RS\n.nf\n%s\n.fi\n.RE\n", roffEscape(e.Command))
+		}
+	}
+	var seeAlso []string
+	if len(parents) > 0 {
+		seeAlso = append(seeAlso, fmt.Sprintf("\\fB%s\\fP(%s)", roffEscape(strings.Join(parents, "-")), section))
+	}
+	for _, s := range cmd.AllSubCommands() {
+		seeAlso = append(seeAlso, fmt.Sprintf("\\fB%s\\fP(%s)", roffEscape(basename(s, append(parents, cmd.Name), "-")), section))
+	}
+	if len(seeAlso) > 0 {
+		fmt.Fprintf(b, ".SH SEE ALSO\n%s\n", strings.Join(seeAlso, ", "))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+var (
+	roffInline = regexp.MustCompile("`[^`]+`|\\*\\*[^*]+\\*\\*|__[^_]+__|\\*[^*\\s][^*]*\\*|_[^_\\s][^_]*_|\\[[^\\]]+\\]\\([^)]+\\)")
+	roffList   = regexp.MustCompile(`^\s*([-*+]|\d+[.)])\s+(.*)$`)
+)
+
+// roffEscape escapes backslashes, dashes and leading control characters of plain text
+func roffEscape(s string) string {
+	return roffLine(escapeText(s))
+}
+
+func escapeText(s string) string {
+	s = strings.Replace(s, "\\", "\\e", -1)
+	return strings.Replace(s, "-", "\\-", -1)
+}
+
+// roffLine protects a line starting with a dot or quote from being read as a request
+func roffLine(s string) string {
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		return "\\&" + s
+	}
+	return s
+}
+
+// roffInlineMarkup converts inline Markdown to roff font escapes
+func roffInlineMarkup(s string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range roffInline.FindAllStringIndex(s, -1) {
+		b.WriteString(escapeText(s[last:m[0]]))
+		tok := s[m[0]:m[1]]
+		switch {
+		case strings.HasPrefix(tok, "`"):
+			b.WriteString("\\fB" + escapeText(tok[1:len(tok)-1]) + "\\fP")
+		case strings.HasPrefix(tok, "**"), strings.HasPrefix(tok, "__"):
+			b.WriteString("\\fB" + escapeText(tok[2:len(tok)-2]) + "\\fP")
+		case strings.HasPrefix(tok, "["):
+			i := strings.Index(tok, "](")
+			b.WriteString(escapeText(tok[1:i]) + " <" + escapeText(tok[i+2:len(tok)-1]) + ">")
+		default:
+			b.WriteString("\\fI" + escapeText(tok[1:len(tok)-1]) + "\\fP")
+		}
+		last = m[1]
+	}
+	b.WriteString(escapeText(s[last:]))
+	return roffLine(b.String())
+}
+
+// markdownToRoff converts the Markdown of a ManPage to roff requests
+func markdownToRoff(md string) string {
+	var b strings.Builder
+	lines := strings.Split(strings.Replace(md, "\r\n", "\n", -1), "\n")
+	inPara := false
+	for i := 0; i < len(lines); i++ {
+		t := strings.TrimSpace(lines[i])
+		switch {
+		case t == "":
+			inPara = false
+		case strings.HasPrefix(t, "```"):
+			b.WriteString(".PP\n.RS\n.nf\n")
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				b.WriteString(roffEscape(lines[i]) + "\n")
+			}
+			b.WriteString(".fi\n.RE\n")
+			inPara = false
+		case strings.HasPrefix(t, "#"):
+			level := len(t) - len(strings.TrimLeft(t, "#"))
+			text := strings.ToUpper(strings.TrimSpace(strings.Trim(t, "#")))
+			if level == 1 {
+				fmt.Fprintf(&b, ".SH \"%s\"\n", roffEscape(text))
+			} else {
+				fmt.Fprintf(&b, ".SS \"%s\"\n", roffEscape(strings.TrimSpace(strings.Trim(t, "#"))))
+			}
+			inPara = false
+		case roffList.MatchString(lines[i]):
+			m := roffList.FindStringSubmatch(lines[i])
+			bullet := "\\(bu"
+			if m[1] != "-" && m[1] != "*" && m[1] != "+" {
+				bullet = m[1]
+			}
+			fmt.Fprintf(&b, ".IP \"%s\" 4\n%s\n", bullet, roffInlineMarkup(m[2]))
+			inPara = true
+		case strings.HasPrefix(t, ">"):
+			fmt.Fprintf(&b, ".RS\n%s\n.RE\n", roffInlineMarkup(strings.TrimSpace(strings.TrimPrefix(t, ">"))))
+			inPara = false
+		default:
+			if !inPara {
+				b.WriteString(".PP\n")
+				inPara = true
+			}
+			b.WriteString(roffInlineMarkup(t) + "\n")
+		}
+	}
+	return b.String()
+}
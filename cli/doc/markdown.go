@@ -0,0 +1,104 @@
+package doc
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/loicalleyne/cli/cli"
+	"github.com/loicalleyne/cli/command"
+)
+
+// GenMarkdownTree writes one Markdown file per command of c into dir, e.g. dir/github_login.md
+func GenMarkdownTree(c *cli.Cli, dir string) error {
+	return walk(c.CommandList(), nil, func(cmd command.Command, parents []string) error {
+		f, err := os.Create(filepath.Join(dir, basename(cmd, parents, "_")+".md"))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return GenMarkdown(cmd, parents, f)
+	})
+}
+
+// GenMarkdown writes the Markdown documentation of cmd to w, parents are the names of the commands above it
+// The ManPage of the command is included with its headings demoted below the page title
+func GenMarkdown(cmd command.Command, parents []string, w io.Writer) error {
+	b := &strings.Builder{}
+	p := path(cmd, parents)
+
+	fmt.Fprintf(b, "# %s\n\n", p)
+	if cmd.Help != "" {
+		fmt.Fprintf(b, "%s\n\n", cmd.Help)
+	}
+	fmt.Fprintf(b, "## Usage\n\n```\n%s\n```\n\n", cmd.UsageLine(p))
+	if len(cmd.Aliases) > 0 {
+		fmt.Fprintf(b, "## Aliases\n\n%s\n\n", strings.Join(cmd.Aliases, ", "))
+	}
+	if len(cmd.Args) > 0 {
+		fmt.Fprintf(b, "## Arguments\n\n| Argument | Description |\n| --- | --- |\n")
+		for _, a := range cmd.Args {
+			fmt.Fprintf(b, "| `%s` | %s |\n", a.Synopsis(), escapeTable(a.Help))
+		}
+		fmt.Fprintln(b)
+	}
+	if len(cmd.Flags) > 0 {
+		fmt.Fprintf(b, "## Flags\n\n| Flag | Default | Description |\n| --- | --- | --- |\n")
+		for _, f := range cmd.Flags {
+			def := ""
+			if f.Default != "" {
+				def = "`" + f.Default + "`"
+			}
+			fmt.Fprintf(b, "| `%s` | %s | %s |\n", strings.TrimSpace(f.Synopsis()), def, escapeTable(f.Help))
+		}
+		fmt.Fprintln(b)
+	}
+	if len(cmd.Examples) > 0 {
+		fmt.Fprintf(b, "## Examples\n\n")
+		for _, e := range cmd.Examples {
+			if e.Help != "" {
+				fmt.Fprintf(b, "%s\n\n", e.Help)
+			}
+			fmt.Fprintf(b, "```\n%s\n```\n\n", e.Command)
+		}
+	}
+	if strings.TrimSpace(cmd.ManPage) != "" {
+		fmt.Fprintf(b, "## Description\n\n%s\n\n", demoteHeadings(strings.TrimSpace(cmd.ManPage)))
+	}
+	if subs := cmd.AllSubCommands(); len(subs) > 0 {
+		fmt.Fprintf(b, "## Subcommands\n\n")
+		for _, s := range subs {
+			fmt.Fprintf(b, "* [%s](%s.md) - %s\n", path(s, append(parents, cmd.Name)), basename(s, append(parents, cmd.Name), "_"), s.Help)
+		}
+		fmt.Fprintln(b)
+	}
+	if len(parents) > 0 {
+		fmt.Fprintf(b, "## See also\n\n* [%s](%s.md)\n", strings.Join(parents, " "), strings.Join(parents, "_"))
+	}
+
+	_, err := io.WriteString(w, strings.TrimRight(b.String(), "\n")+"\n")
+	return err
+}
+
+func escapeTable(s string) string {
+	return strings.Replace(s, "|", "\\|", -1)
+}
+
+// demoteHeadings moves every Markdown heading outside code blocks two levels down
+// so ManPage content nests under the "Description" section
+func demoteHeadings(md string) string {
+	lines := strings.Split(md, "\n")
+	fenced := false
+	for i, l := range lines {
+		t := strings.TrimSpace(l)
+		if strings.HasPrefix(t, "```") {
+			fenced = !fenced
+		}
+		if !fenced && strings.HasPrefix(t, "#") {
+			lines[i] = "##" + t
+		}
+	}
+	return strings.Join(lines, "\n")
+}
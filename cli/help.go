@@ -0,0 +1,205 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fatih/color"
+	"github.com/loicalleyne/cli/command"
+)
+
+// systemCommands are the root commands handled by parseSystemCommands
+// They cannot be used as names for registered root commands
+var systemCommands = []command.Command{
+	{Name: "help", Usage: "[command...]", Help: "show help for a command, e.g. help github login"},
+	{Name: "man", Usage: "[command...]", Help: "show the manpage of a command"},
+	{Name: "apropos", Usage: "<word...>", Help: "search commands by name, alias, help, examples and manpage"},
+	{Name: "set", Usage: "[name [value...]]", Help: "list the session variables, set one or unset it when no value is given, used in input as $name"},
+	{Name: "jobs", Help: "list the commands started in the background with a trailing &"},
+	{Name: "fg", Usage: "[job]", Help: "show the output of a background job and wait for it, the latest one by default"},
+	{Name: "wait", Usage: "[job]", Help: "wait for a background job, all of them by default"},
+	{Name: "kill", Usage: "<job>", Help: "cancel a background job, or discard the output of a finished one"},
+	{Name: "watch", Usage: "[-n interval] <command...>", Help: "run a command every interval, 2s by default, highlighting what changed until Ctrl-C"},
+	{Name: "schedule", Help: "run commands on cron schedules while the REPL runs", SubCommands: []command.Command{
+		{Name: "add", Usage: "<cron expression> <command...>", Help: "schedule a command, e.g. schedule add \"*/15 * * * *\" sync or schedule add @daily backup"},
+		{Name: "list", Help: "list the schedules with their next run and the status of their last one"},
+		{Name: "rm", Usage: "<id>", Help: "remove a schedule"},
+		{Name: "history", Usage: "[id]", Help: "show the start, duration and status of the last runs"},
+	}},
+	{Name: "clear", Help: "clear the screen"},
+	{Name: "exit", Help: "exit the program"},
+}
+
+var heading = color.New(color.Bold).SprintFunc()
+
+// systemCommand returns the deepest system command named by the first words of args, e.g. schedule add,
+// and the number of words naming it, 0 when args do not start with a system command
+func systemCommand(args []string) (command.Command, int) {
+	var c command.Command
+	commands := systemCommands
+	n := 0
+	for _, name := range args {
+		found := false
+		for _, s := range commands {
+			if s.Name == name {
+				c, found = s, true
+				break
+			}
+		}
+		if !found {
+			break
+		}
+		commands = c.SubCommands
+		n++
+	}
+	return c, n
+}
+
+// wantsHelp reports whether args request help with --help or -h
+func wantsHelp(args []string) bool {
+	for _, a := range args {
+		if a == "--help" || a == "-h" {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve walks the command tree along args, matching names and aliases
+// It returns the chain of matched commands and the args left once no subcommand matches
+// and fails when a dynamic command on the way returns invalid subcommands
+func (cli *Cli) resolve(args []string) ([]command.Command, []string, error) {
+	return cli.commandIndex().resolve(args)
+}
+
+func chainNames(chain []command.Command) []string {
+	names := make([]string, 0, len(chain))
+	for _, c := range chain {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// Help writes the help of the command found at path to w, names and aliases are both accepted
+// An empty path writes the overview of root and system commands
+func (cli *Cli) Help(w io.Writer, path ...string) error {
+	if len(path) == 0 {
+		cli.printOverview(w)
+		return nil
+	}
+	if isSystemCommand(path[0]) {
+		c, n := systemCommand(path)
+		if n < len(path) {
+			return fmt.Errorf("unknown command %q, see help", strings.Join(path, " "))
+		}
+		writeCommandHelp(w, c, path[:n-1])
+		return nil
+	}
+	chain, rest, err := cli.resolve(path)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return fmt.Errorf("unknown command %q, see help", strings.Join(path, " "))
+	}
+	names := chainNames(chain)
+	writeCommandHelp(w, chain[len(chain)-1], names[:len(names)-1])
+	return nil
+}
+
+func (cli *Cli) printOverview(w io.Writer) {
+	fmt.Fprintf(w, "%s\n  <command> [subcommand...] [args] [flags]\n\n", heading("Usage:"))
+	writeCommandList(w, cli.commands(), "Commands")
+	writeCommandList(w, systemCommands, "System commands")
+	fmt.Fprintf(w, "Use \"help <command>\" or \"<command> --help\" for more information about a command.\n")
+}
+
+// writeCommandHelp writes the full help of c, parents are the names of the commands above it
+func writeCommandHelp(w io.Writer, c command.Command, parents []string) {
+	path := strings.Join(append(append([]string{}, parents...), c.Name), " ")
+	if c.Help != "" {
+		fmt.Fprintf(w, "%s\n\n", c.Help)
+	}
+	fmt.Fprintf(w, "%s\n  %s\n\n", heading("Usage:"), c.UsageLine(path))
+	if len(c.Aliases) > 0 {
+		fmt.Fprintf(w, "%s\n  %s\n\n", heading("Aliases:"), strings.Join(append([]string{c.Name}, c.Aliases...), ", "))
+	}
+	if len(c.Args) > 0 {
+		fmt.Fprintf(w, "%s\n", heading("Arguments:"))
+		tw := tabwriter.NewWriter(w, 0, 4, 3, ' ', 0)
+		for _, a := range c.Args {
+			help := a.Help
+			if len(a.Enum) > 0 {
+				help += fmt.Sprintf(" (one of %s)", strings.Join(a.Enum, ", "))
+			}
+			fmt.Fprintf(tw, "  %s\t%s\n", a.Synopsis(), help)
+		}
+		tw.Flush()
+		fmt.Fprintln(w)
+	}
+	if len(c.Flags) > 0 {
+		fmt.Fprintf(w, "%s\n", heading("Flags:"))
+		tw := tabwriter.NewWriter(w, 0, 4, 3, ' ', 0)
+		for _, f := range c.Flags {
+			help := f.Help
+			if f.Default != "" {
+				help += fmt.Sprintf(" (default %q)", f.Default)
+			}
+			if len(f.Enum) > 0 {
+				help += fmt.Sprintf(" (one of %s)", strings.Join(f.Enum, ", "))
+			}
+			fmt.Fprintf(tw, "  %s\t%s\n", f.Synopsis(), help)
+		}
+		tw.Flush()
+		fmt.Fprintln(w)
+	}
+	if len(c.Examples) > 0 {
+		fmt.Fprintf(w, "%s\n", heading("Examples:"))
+		for _, e := range c.Examples {
+			fmt.Fprintf(w, "  %s\n", e.Command)
+			if e.Help != "" {
+				fmt.Fprintf(w, "      %s\n", e.Help)
+			}
+		}
+		fmt.Fprintln(w)
+	}
+	if subs := c.AllSubCommands(); len(subs) > 0 {
+		writeCommandList(w, subs, "Subcommands")
+		fmt.Fprintf(w, "Use \"help %s <command>\" for more information about a subcommand.\n", path)
+	}
+}
+
+// writeCommandList writes the names and help of commands grouped by category
+// Commands without a category are listed under title
+func writeCommandList(w io.Writer, commands []command.Command, title string) {
+	var categories []string
+	groups := map[string][]command.Command{}
+	for _, c := range commands {
+		if c.Name == "." {
+			continue
+		}
+		if _, ok := groups[c.Category]; !ok {
+			categories = append(categories, c.Category)
+		}
+		groups[c.Category] = append(groups[c.Category], c)
+	}
+	for _, category := range categories {
+		name := category
+		if name == "" {
+			name = title
+		}
+		fmt.Fprintf(w, "%s\n", heading(name+":"))
+		tw := tabwriter.NewWriter(w, 0, 4, 3, ' ', 0)
+		for _, c := range groups[category] {
+			names := c.Name
+			if len(c.Aliases) > 0 {
+				names += " (" + strings.Join(c.Aliases, ", ") + ")"
+			}
+			fmt.Fprintf(tw, "  %s\t%s\n", names, c.Help)
+		}
+		tw.Flush()
+		fmt.Fprintln(w)
+	}
+}
@@ -4,10 +4,12 @@ import "github.com/loicalleyne/cli/command"
 
 // ICli is the common mockable interface for Cli
 type ICli interface {
-	AddCommand(c command.ICommand)
+	AddCommand(c command.ICommand) error
 }
 
 // AddCommand for Cli commands
-func AddCommand(i ICli, c command.ICommand) {
-	i.AddCommand(c)
+func AddCommand(i ICli, c command.ICommand) error {
+	return i.AddCommand(c)
 }
+
+var _ ICli = (*Cli)(nil)
@@ -0,0 +1,132 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/loicalleyne/cli/vault"
+)
+
+// idleCheck is how often the idle timeout is checked when it is disabled, so it can be enabled while running
+const idleCheck = time.Second
+
+// SetIdleTimeout locks the vault described by info once no session has read a line or run a command for d,
+// zero disables it. A command running in the foreground of a session counts as activity until it returns.
+// Locking forgets the master password and the open database and clears the screen. The next line typed
+// in the terminal first prompts for the master password with vault.DbUnlockPrompt and only runs once the
+// vault is open again. Remote sessions, JSON-RPC and tool calls and scheduled runs get an error until then.
+func (cli *Cli) SetIdleTimeout(d time.Duration, info *vault.VaultInfo) {
+	cli.mu.Lock()
+	cli.idleTimeout = d
+	cli.vaultInfo = info
+	cli.mu.Unlock()
+}
+
+// Locked reports whether the vault was locked by the idle timeout and not unlocked since
+func (cli *Cli) Locked() bool {
+	cli.mu.RLock()
+	defer cli.mu.RUnlock()
+	return cli.locked
+}
+
+// watchIdle locks the vault whenever the idle timeout is exceeded, until ctx is done
+func (cli *Cli) watchIdle(ctx context.Context) {
+	timer := time.NewTimer(cli.lockIfIdle())
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			timer.Reset(cli.lockIfIdle())
+		}
+	}
+}
+
+// lockIfIdle locks the vault if the idle timeout is exceeded and returns when to check again
+func (cli *Cli) lockIfIdle() time.Duration {
+	cli.mu.Lock()
+	timeout, info, db := cli.idleTimeout, cli.vaultInfo, cli.Vault
+	if timeout <= 0 || info == nil {
+		cli.mu.Unlock()
+		return idleCheck
+	}
+	if idle := time.Since(cli.LastInteraction); idle < timeout {
+		cli.mu.Unlock()
+		return timeout - idle
+	}
+	if cli.busy > 0 {
+		// the command touches the Cli when it returns
+		cli.mu.Unlock()
+		return timeout
+	}
+	if cli.locked || (db == nil && info.MasterPassword == "") {
+		// nothing to lock, an idle Cli is checked again after a full timeout
+		cli.mu.Unlock()
+		return timeout
+	}
+	err := vault.LockDB(db, info)
+	cli.locked = true
+	cli.Vault = nil
+	cli.mu.Unlock()
+
+	// an editor or shell owns the screen while the terminal is handed over
+	if !cli.handingOff() {
+		w := io.Writer(os.Stdout)
+		if s := cli.scanner(); s != nil {
+			// the writer of the readline instance redraws the prompt after the message
+			w = s.Stdout()
+		}
+		fmt.Fprint(w, "\033[H\033[2J")
+		fmt.Fprintf(w, "vault locked after %s of inactivity\n", timeout)
+		if err != nil {
+			fmt.Fprintln(w, color.RedString(err.Error()))
+		}
+	}
+	return timeout
+}
+
+// running counts a command running in the foreground as activity until the returned func is called
+func (cli *Cli) running() func() {
+	cli.mu.Lock()
+	cli.busy++
+	cli.mu.Unlock()
+	return func() {
+		cli.mu.Lock()
+		cli.busy--
+		cli.LastInteraction = time.Now()
+		cli.mu.Unlock()
+	}
+}
+
+// unlock prompts for the master password of a vault locked by the idle timeout and opens it again
+// Every dispatch calls it before running a command, remote ones cannot prompt and get an error.
+func (cli *Cli) unlock(remote bool) error {
+	cli.mu.RLock()
+	locked, info := cli.locked, cli.vaultInfo
+	cli.mu.RUnlock()
+	if !locked {
+		return nil
+	}
+	if remote {
+		return fmt.Errorf("vault locked after inactivity, unlock it from the terminal")
+	}
+	var db vault.Database
+	err := cli.WithTerminal(func() error {
+		var err error
+		db, err = vault.UnlockDB(info)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("vault locked: %v", err)
+	}
+	cli.mu.Lock()
+	cli.Vault = db
+	cli.locked = false
+	cli.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,223 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// job is a command line run in the background of a session with cmd &
+type job struct {
+	id     int
+	line   string
+	cancel context.CancelFunc
+	out    outputBuffer
+	// done is closed once err is set
+	done chan struct{}
+	err  error
+	// killed, foreground and reported are guarded by the jobs mutex of the session
+	killed     bool
+	foreground bool
+	// reported jobs have had their completion notice shown and are forgotten
+	reported bool
+}
+
+// status describes the state of j for jobs and completion notices, it is called with the jobs mutex held
+func (j *job) status() string {
+	select {
+	case <-j.done:
+	default:
+		return "Running"
+	}
+	switch {
+	case j.killed:
+		return "Killed"
+	case j.err != nil && j.err != errExit:
+		return "Failed: " + j.err.Error()
+	}
+	return "Done"
+}
+
+// background starts line as a job of the session and prints its number
+// The job runs in a session of its own writing to a buffer, and it is cancelled by kill or when ctx is done.
+// Commands only setting Func are refused, what they print to the process stdout could not be buffered.
+// Unless fg shows it, a finished job is reported with its output above the prompt and forgotten, as in shells.
+func (s *Session) background(ctx context.Context, line string) error {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return fmt.Errorf("&: no command to run in the background")
+	}
+	if err := s.cli.checkCaptured(line); err != nil {
+		return fmt.Errorf("&: %w", err)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	vars := make(map[string]string, len(s.Vars))
+	for k, v := range s.Vars {
+		vars[k] = v
+	}
+
+	s.jobsMu.Lock()
+	if len(s.jobs) == 0 {
+		s.lastJob = 0
+	}
+	s.lastJob++
+	j := &job{id: s.lastJob, line: line, cancel: cancel, done: make(chan struct{})}
+	s.jobs = append(s.jobs, j)
+	s.jobsMu.Unlock()
+
+	// remote since the job does not own the process terminal
+	js := &Session{Prompt: s.Prompt, Vars: vars, cli: s.cli, out: &j.out, remote: true}
+	go func() {
+		err := s.cli.findCommand(js.context(ctx), line)
+		cancel()
+		j.err = err
+		close(j.done)
+
+		s.jobsMu.Lock()
+		foreground, status := j.foreground, j.status()
+		if !foreground {
+			j.reported = true
+		}
+		s.jobsMu.Unlock()
+		if foreground {
+			return
+		}
+		s.forget(j)
+		msg := fmt.Sprintf("[%d] %s\t%s", j.id, status, j.line)
+		if output := strings.TrimRight(j.out.String(), "\n"); output != "" {
+			msg += "\n" + output
+		}
+		s.notify(msg)
+	}()
+	fmt.Fprintf(s.out, "[%d] %s\n", j.id, line)
+	return nil
+}
+
+// job returns the job named by args, the most recent one when args is empty
+func (s *Session) job(args []string) (*job, error) {
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+	if len(s.jobs) == 0 {
+		return nil, fmt.Errorf("no jobs")
+	}
+	if len(args) == 0 {
+		return s.jobs[len(s.jobs)-1], nil
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(args[0], "%"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid job %q", args[0])
+	}
+	for _, j := range s.jobs {
+		if j.id == id {
+			return j, nil
+		}
+	}
+	return nil, fmt.Errorf("no job %d", id)
+}
+
+// forget removes j from the jobs of the session
+func (s *Session) forget(j *job) {
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+	for i, o := range s.jobs {
+		if o == j {
+			s.jobs = append(s.jobs[:i:i], s.jobs[i+1:]...)
+			return
+		}
+	}
+}
+
+// listJobs implements the jobs command
+func (s *Session) listJobs() error {
+	var b bytes.Buffer
+	tw := tabwriter.NewWriter(&b, 0, 4, 3, ' ', 0)
+	s.jobsMu.Lock()
+	for _, j := range s.jobs {
+		fmt.Fprintf(tw, "[%d]\t%s\t%s\n", j.id, j.status(), j.line)
+	}
+	s.jobsMu.Unlock()
+	tw.Flush()
+	_, err := s.out.Write(b.Bytes())
+	return err
+}
+
+// fg implements the fg command: it shows the output of a job, waits for it and returns its error
+func (s *Session) fg(ctx context.Context, args []string) error {
+	j, err := s.job(args)
+	if err != nil {
+		return err
+	}
+	s.jobsMu.Lock()
+	reported := j.reported
+	j.foreground = !reported
+	s.jobsMu.Unlock()
+	if reported {
+		// it finished since it was looked up
+		return fmt.Errorf("no job %d", j.id)
+	}
+	fmt.Fprintln(s.out, j.line)
+	j.out.attach(s.out)
+	select {
+	case <-j.done:
+	case <-ctx.Done():
+		j.cancel()
+		<-j.done
+	}
+	s.forget(j)
+	s.jobsMu.Lock()
+	killed := j.killed
+	s.jobsMu.Unlock()
+	if killed || j.err == errExit {
+		return nil
+	}
+	return j.err
+}
+
+// wait implements the wait command: it waits for a job, all of them when args is empty
+func (s *Session) wait(ctx context.Context, args []string) error {
+	var jobs []*job
+	if len(args) > 0 {
+		j, err := s.job(args)
+		if err != nil {
+			return err
+		}
+		jobs = []*job{j}
+	} else {
+		s.jobsMu.Lock()
+		jobs = s.jobs
+		s.jobsMu.Unlock()
+	}
+	for _, j := range jobs {
+		select {
+		case <-j.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// kill implements the kill command: it cancels the context of a running job
+func (s *Session) kill(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("kill: usage: kill <job>")
+	}
+	j, err := s.job(args)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-j.done:
+		// it is about to be reported
+		return nil
+	default:
+	}
+	s.jobsMu.Lock()
+	j.killed = true
+	s.jobsMu.Unlock()
+	j.cancel()
+	return nil
+}
@@ -0,0 +1,207 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/loicalleyne/cli/command"
+	toml "github.com/pelletier/go-toml/v2"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// CommandSpec is the file representation of a command, see LoadCommands
+type CommandSpec struct {
+	Name     string            `json:"name" yaml:"name" toml:"name"`
+	Aliases  []string          `json:"aliases" yaml:"aliases" toml:"aliases"`
+	Category string            `json:"category" yaml:"category" toml:"category"`
+	Usage    string            `json:"usage" yaml:"usage" toml:"usage"`
+	Help     string            `json:"help" yaml:"help" toml:"help"`
+	ManPage  string            `json:"manpage" yaml:"manpage" toml:"manpage"`
+	Args     []command.Arg     `json:"args" yaml:"args" toml:"args"`
+	Flags    []command.Flag    `json:"flags" yaml:"flags" toml:"flags"`
+	Examples []command.Example `json:"examples" yaml:"examples" toml:"examples"`
+	// Dangerous marks the command as command.Command.Dangerous
+	Dangerous bool `json:"dangerous" yaml:"dangerous" toml:"dangerous"`
+	// Handler is the name of a Go handler registered with RegisterHandler
+	Handler string `json:"handler" yaml:"handler" toml:"handler"`
+	// Shell is a text/template run with sh -c, see LoadCommands for the template data
+	Shell       string        `json:"shell" yaml:"shell" toml:"shell"`
+	SubCommands []CommandSpec `json:"subcommands" yaml:"subcommands" toml:"subcommands"`
+}
+
+// commandFile is the top level of a command file
+type commandFile struct {
+	Commands []CommandSpec `json:"commands" yaml:"commands" toml:"commands"`
+}
+
+// RegisterHandler makes h available to the handler field of loaded command specs under name
+// Handlers must be registered before LoadCommands is called
+func (cli *Cli) RegisterHandler(name string, h func(ctx context.Context, args []string) error) {
+	cli.mu.Lock()
+	defer cli.mu.Unlock()
+	if cli.handlers == nil {
+		cli.handlers = map[string]func(ctx context.Context, args []string) error{}
+	}
+	cli.handlers[name] = h
+}
+
+// LoadCommands reads the command trees in the file at path and adds them to the Cli
+// The format is chosen from the extension: .json, .yaml, .yml or .toml, e.g. in YAML:
+//
+//	commands:
+//	  - name: deploy
+//	    help: deploy a service
+//	    args:
+//	      - name: service
+//	        required: true
+//	    flags:
+//	      - name: env
+//	        value: env
+//	        default: staging
+//	    shell: ./deploy.sh --env {{.Flag.env}} {{.Arg.service}}
+//
+// The action of a command is either handler, naming a Go handler registered with RegisterHandler,
+// or shell, a text/template rendered and run with sh -c, or cmd /S /C on Windows. The template data has Args,
+// every positional arg, Arg, the positional args by name, and Flag, the flag values by name with defaults
+// applied and repeated values joined by commas. All values are quoted for the shell running the template.
+// Commands without an action print their help.
+// The file is loaded as a whole: if any command is invalid none of them is added.
+func (cli *Cli) LoadCommands(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var f commandFile
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		err = json.Unmarshal(b, &f)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &f)
+	case ".toml":
+		err = toml.Unmarshal(b, &f)
+	default:
+		return fmt.Errorf("%s: unsupported command file format %q", path, ext)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	var commands []command.Command
+	for _, spec := range f.Commands {
+		c, err := cli.specCommand(spec)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		commands = append(commands, c)
+	}
+	if err := cli.addCommands(commands...); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
+
+// specCommand converts spec and its subcommands to a Command
+func (cli *Cli) specCommand(spec CommandSpec) (command.Command, error) {
+	c := command.Command{
+		Name:      spec.Name,
+		Aliases:   spec.Aliases,
+		Category:  spec.Category,
+		Usage:     spec.Usage,
+		Help:      spec.Help,
+		ManPage:   spec.ManPage,
+		Args:      spec.Args,
+		Flags:     spec.Flags,
+		Examples:  spec.Examples,
+		Dangerous: spec.Dangerous,
+	}
+	switch {
+	case spec.Handler != "" && spec.Shell != "":
+		return c, fmt.Errorf("%q: handler and shell are mutually exclusive", spec.Name)
+	case spec.Handler != "":
+		cli.mu.RLock()
+		h, ok := cli.handlers[spec.Handler]
+		cli.mu.RUnlock()
+		if !ok {
+			return c, fmt.Errorf("%q: no handler registered as %q", spec.Name, spec.Handler)
+		}
+		c.Handler = h
+	case spec.Shell != "":
+		tmpl, err := template.New(spec.Name).Option("missingkey=zero").Parse(spec.Shell)
+		if err != nil {
+			return c, fmt.Errorf("%q: %v", spec.Name, err)
+		}
+		c.Handler = shellHandler(c, tmpl)
+	}
+	for _, s := range spec.SubCommands {
+		sub, err := cli.specCommand(s)
+		if err != nil {
+			return c, err
+		}
+		c.SubCommands = append(c.SubCommands, sub)
+	}
+	return c, nil
+}
+
+// shellData is the data of shell templates, every value is quoted with shellQuote
+type shellData struct {
+	Args string
+	Arg  map[string]string
+	Flag map[string]string
+}
+
+// shellHandler returns a handler rendering tmpl with the args and flags of c and running it with the shell
+func shellHandler(c command.Command, tmpl *template.Template) func(ctx context.Context, args []string) error {
+	return func(ctx context.Context, args []string) error {
+		positional, values, err := command.Parse(c.Flags, args)
+		if err != nil {
+			return err
+		}
+		data := shellData{Arg: map[string]string{}, Flag: map[string]string{}}
+		var quoted []string
+		for _, p := range positional {
+			quoted = append(quoted, shellQuote(p))
+		}
+		data.Args = strings.Join(quoted, " ")
+		for i, a := range c.Args {
+			switch {
+			case a.Variadic && i < len(quoted):
+				data.Arg[a.Name] = strings.Join(quoted[i:], " ")
+			case i < len(quoted):
+				data.Arg[a.Name] = quoted[i]
+			case a.Required:
+				return fmt.Errorf("missing argument <%s>", a.Name)
+			}
+		}
+		for _, f := range c.Flags {
+			if v, ok := values[f.Name]; ok {
+				data.Flag[f.Name] = shellQuote(strings.Join(v, ","))
+			} else if f.Default != "" {
+				data.Flag[f.Name] = shellQuote(f.Default)
+			}
+		}
+
+		var script bytes.Buffer
+		if err := tmpl.Execute(&script, data); err != nil {
+			return err
+		}
+		cmd := shellCommand(ctx, script.String())
+		setStdio(ctx, cmd)
+		return cmd.Run()
+	}
+}
+
+// setStdio connects cmd to Output(ctx), it only reads the process stdin when it writes to the terminal
+func setStdio(ctx context.Context, cmd *exec.Cmd) {
+	w := Output(ctx)
+	cmd.Stdout, cmd.Stderr = w, w
+	if w == os.Stdout {
+		cmd.Stdin, cmd.Stderr = os.Stdin, os.Stderr
+	}
+}
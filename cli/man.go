@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/loicalleyne/cli/command"
+)
+
+// manPaths returns the path of every command in the tree that has a manpage
+func manPaths(commands []command.Command, parents []string) []string {
+	var paths []string
+	for _, c := range commands {
+		path := append(append([]string{}, parents...), c.Name)
+		if strings.TrimSpace(c.ManPage) != "" {
+			paths = append(paths, strings.Join(path, " "))
+		}
+		paths = append(paths, manPaths(c.AllSubCommands(), path)...)
+	}
+	return paths
+}
+
+// manLines renders the manpage of the command found at path for a terminal width columns wide
+func (cli *Cli) manLines(path []string, width int) ([]string, error) {
+	chain, rest, err := cli.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("unknown command %q, see help", strings.Join(path, " "))
+	}
+	c := chain[len(chain)-1]
+	name := strings.Join(chainNames(chain), " ")
+	if strings.TrimSpace(c.ManPage) == "" {
+		return nil, fmt.Errorf("no manpage for %q, see help %s", name, name)
+	}
+	if width > 100 {
+		width = 100
+	}
+	if width < 40 {
+		width = 40
+	}
+	lines := []string{mdHeading(strings.ToUpper(name)), ""}
+	if c.Help != "" {
+		lines = append(lines, wrapMarkdown(name+" - "+c.Help, width, mdMargin, mdMargin)...)
+		lines = append(lines, "")
+	}
+	return append(lines, renderMarkdown(c.ManPage, width)...), nil
+}
+
+// Man writes the rendered Markdown manpage of the command found at path to w
+// An empty path lists the commands that have a manpage
+func (cli *Cli) Man(w io.Writer, path ...string) error {
+	if len(path) == 0 {
+		paths := manPaths(cli.commands(), nil)
+		if len(paths) == 0 {
+			return fmt.Errorf("no manpages found")
+		}
+		fmt.Fprintf(w, "%s\n", heading("Manpages:"))
+		for _, p := range paths {
+			fmt.Fprintf(w, "  %s\n", p)
+		}
+		return nil
+	}
+	width, _ := terminalSize()
+	lines, err := cli.manLines(path, width)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, strings.Join(lines, "\n"))
+	return nil
+}
+
+// showMan displays a manpage on the terminal, through the pager when it is longer than the screen
+func (cli *Cli) showMan(path []string) error {
+	if len(path) == 0 {
+		return cli.Man(os.Stdout, path...)
+	}
+	width, _ := terminalSize()
+	lines, err := cli.manLines(path, width)
+	if err != nil {
+		return err
+	}
+	return cli.WithTerminal(func() error {
+		return show(lines)
+	})
+}
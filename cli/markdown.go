@@ -0,0 +1,206 @@
+package cli
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/fatih/color"
+)
+
+// markdown styles, they render as plain text when color is disabled
+var (
+	mdHeading    = color.New(color.Bold).SprintFunc()
+	mdSubheading = color.New(color.Bold, color.Italic).SprintFunc()
+	mdBold       = color.New(color.Bold).SprintFunc()
+	mdItalic     = color.New(color.Italic).SprintFunc()
+	mdCode       = color.New(color.FgCyan).SprintFunc()
+	mdLink       = color.New(color.Underline).SprintFunc()
+	mdFaint      = color.New(color.Faint).SprintFunc()
+	mdPlain      = func(a ...interface{}) string { return a[0].(string) }
+)
+
+const mdMargin = "    "
+
+var (
+	mdInline = regexp.MustCompile("`[^`]+`|\\*\\*[^*]+\\*\\*|__[^_]+__|\\*[^*\\s][^*]*\\*|_[^_\\s][^_]*_|\\[[^\\]]+\\]\\([^)]+\\)")
+	mdList   = regexp.MustCompile(`^(\s*)([-*+]|\d+[.)])\s+(.*)$`)
+	mdRule   = regexp.MustCompile(`^(\*\s*){3,}$|^(-\s*){3,}$|^(_\s*){3,}$`)
+)
+
+// piece is a run of text sharing a single inline style
+type piece struct {
+	text  string
+	style func(a ...interface{}) string
+}
+
+// inlinePieces splits s on inline markup: `code`, **bold**, *italic* and [links](url)
+func inlinePieces(s string) []piece {
+	var pieces []piece
+	last := 0
+	for _, m := range mdInline.FindAllStringIndex(s, -1) {
+		if m[0] > last {
+			pieces = append(pieces, piece{s[last:m[0]], mdPlain})
+		}
+		tok := s[m[0]:m[1]]
+		switch {
+		case strings.HasPrefix(tok, "`"):
+			pieces = append(pieces, piece{tok[1 : len(tok)-1], mdCode})
+		case strings.HasPrefix(tok, "**"), strings.HasPrefix(tok, "__"):
+			pieces = append(pieces, piece{tok[2 : len(tok)-2], mdBold})
+		case strings.HasPrefix(tok, "["):
+			i := strings.Index(tok, "](")
+			pieces = append(pieces, piece{tok[1:i], mdLink}, piece{" <" + tok[i+2:len(tok)-1] + ">", mdFaint})
+		default:
+			pieces = append(pieces, piece{tok[1 : len(tok)-1], mdItalic})
+		}
+		last = m[1]
+	}
+	if last < len(s) {
+		pieces = append(pieces, piece{s[last:], mdPlain})
+	}
+	return pieces
+}
+
+// mdWords splits s into words, a word keeps the styles of the pieces it spans
+func mdWords(s string) [][]piece {
+	var words [][]piece
+	var word []piece
+	for _, p := range inlinePieces(s) {
+		for i, part := range strings.Split(p.text, " ") {
+			if i > 0 && len(word) > 0 {
+				words = append(words, word)
+				word = nil
+			}
+			if part != "" {
+				word = append(word, piece{part, p.style})
+			}
+		}
+	}
+	if len(word) > 0 {
+		words = append(words, word)
+	}
+	return words
+}
+
+// wrapMarkdown renders the inline markup of text and wraps it to width visible columns
+// first prefixes the first line and indent the following ones
+func wrapMarkdown(text string, width int, first, indent string) []string {
+	var lines []string
+	prefix := first
+	var line strings.Builder
+	used := 0
+	for _, word := range mdWords(strings.Join(strings.Fields(text), " ")) {
+		n := 0
+		for _, p := range word {
+			n += utf8.RuneCountInString(p.text)
+		}
+		avail := width - utf8.RuneCountInString(prefix)
+		if used > 0 && used+1+n > avail {
+			lines = append(lines, prefix+line.String())
+			line.Reset()
+			prefix = indent
+			used = 0
+		}
+		if used > 0 {
+			line.WriteString(" ")
+			used++
+		}
+		for _, p := range word {
+			line.WriteString(p.style(p.text))
+		}
+		used += n
+	}
+	if used > 0 {
+		lines = append(lines, prefix+line.String())
+	}
+	return lines
+}
+
+// renderMarkdown renders a Markdown document as terminal lines no wider than width
+// Headings, paragraphs, ordered and unordered lists, fenced code blocks,
+// blockquotes, rules and inline code, emphasis and links are supported
+func renderMarkdown(md string, width int) []string {
+	var out []string
+	var para []string
+	blank := func() {
+		if len(out) > 0 && out[len(out)-1] != "" {
+			out = append(out, "")
+		}
+	}
+	flush := func() {
+		if len(para) > 0 {
+			out = append(out, wrapMarkdown(strings.Join(para, " "), width, mdMargin, mdMargin)...)
+			para = nil
+		}
+	}
+
+	lines := strings.Split(strings.Replace(strings.Replace(md, "\r\n", "\n", -1), "\t", "    ", -1), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			flush()
+			blank()
+		case strings.HasPrefix(trimmed, "```"):
+			flush()
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				out = append(out, mdMargin+"    "+mdCode(lines[i]))
+			}
+		case strings.HasPrefix(trimmed, "#"):
+			flush()
+			blank()
+			level := len(trimmed) - len(strings.TrimLeft(trimmed, "#"))
+			text := strings.TrimSpace(strings.Trim(trimmed, "#"))
+			switch level {
+			case 1:
+				out = append(out, mdHeading(strings.ToUpper(text)))
+			case 2:
+				out = append(out, mdHeading(text))
+			default:
+				out = append(out, "  "+mdSubheading(text))
+			}
+		case mdRule.MatchString(trimmed):
+			flush()
+			out = append(out, mdMargin+mdFaint(strings.Repeat("─", width-2*len(mdMargin))))
+		case strings.HasPrefix(trimmed, ">"):
+			flush()
+			text := strings.TrimSpace(strings.TrimPrefix(trimmed, ">"))
+			for i+1 < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i+1]), ">") {
+				i++
+				text += " " + strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(lines[i]), ">"))
+			}
+			bar := mdMargin + mdFaint("│") + " "
+			out = append(out, wrapMarkdown(text, width-2, bar, bar)...)
+		case mdList.MatchString(line):
+			flush()
+			m := mdList.FindStringSubmatch(line)
+			depth := len(m[1]) / 2
+			text := m[3]
+			// continuation lines are indented and are not items themselves
+			for i+1 < len(lines) {
+				next := lines[i+1]
+				if strings.TrimSpace(next) == "" || mdList.MatchString(next) || !strings.HasPrefix(next, " ") {
+					break
+				}
+				i++
+				text += " " + strings.TrimSpace(next)
+			}
+			bullet := "•"
+			if _, err := strconv.Atoi(strings.TrimRight(m[2], ".)")); err == nil {
+				bullet = m[2]
+			}
+			indent := mdMargin + strings.Repeat("  ", depth)
+			out = append(out, wrapMarkdown(text, width, indent+bullet+" ", indent+strings.Repeat(" ", utf8.RuneCountInString(bullet)+1))...)
+		default:
+			para = append(para, trimmed)
+		}
+	}
+	flush()
+	for len(out) > 0 && out[len(out)-1] == "" {
+		out = out[:len(out)-1]
+	}
+	return out
+}
@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/fatih/color"
+)
+
+// Level is the severity of a notification, it sets its color
+type Level int
+
+// Notification levels
+const (
+	LevelInfo Level = iota
+	LevelWarn
+	LevelError
+)
+
+var levelColors = map[Level]*color.Color{
+	LevelInfo:  color.New(color.FgCyan),
+	LevelWarn:  color.New(color.FgYellow),
+	LevelError: color.New(color.FgRed),
+}
+
+// Notify prints msg at LevelInfo, see NotifyLevel
+func (cli *Cli) Notify(msg string) {
+	cli.NotifyLevel(LevelInfo, msg)
+}
+
+// NotifyLevel prints msg in the color of level above the prompt of every running session, the line being
+// typed is redrawn below it. It is safe to call from any goroutine, e.g. a timer or a watcher, and prints
+// to stdout when no session is running.
+func (cli *Cli) NotifyLevel(level Level, msg string) {
+	c, ok := levelColors[level]
+	if !ok {
+		c = levelColors[LevelInfo]
+	}
+	cli.mu.RLock()
+	sessions := make([]*Session, 0, len(cli.sessions))
+	for s := range cli.sessions {
+		sessions = append(sessions, s)
+	}
+	cli.mu.RUnlock()
+	if len(sessions) == 0 {
+		fmt.Fprintln(os.Stdout, c.Sprint(msg))
+		return
+	}
+	for _, s := range sessions {
+		s.notify(c.Sprint(msg))
+	}
+}
+
+// notify prints msg without corrupting the line being edited in the session
+func (s *Session) notify(msg string) {
+	s.notifyMu.Lock()
+	defer s.notifyMu.Unlock()
+	w := s.out
+	if s.Scanner != nil {
+		// the writer of the readline instance clears the prompt and redraws it after msg
+		w = s.Scanner.Stdout()
+	}
+	fmt.Fprintln(w, msg)
+}
+
+// attach registers s as running, to receive notifications
+func (cli *Cli) attach(s *Session) {
+	cli.mu.Lock()
+	defer cli.mu.Unlock()
+	if cli.sessions == nil {
+		cli.sessions = map[*Session]struct{}{}
+	}
+	cli.sessions[s] = struct{}{}
+}
+
+// detach unregisters s once it stops running
+func (cli *Cli) detach(s *Session) {
+	cli.mu.Lock()
+	delete(cli.sessions, s)
+	cli.mu.Unlock()
+}
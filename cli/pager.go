@@ -0,0 +1,163 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/chzyer/readline"
+)
+
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*[a-zA-Z]`)
+
+// terminalSize returns the dimensions of the terminal on stdout, 80x24 when stdout is not a terminal
+func terminalSize() (int, int) {
+	w, h, err := readline.GetSize(int(os.Stdout.Fd()))
+	if err != nil || w <= 0 || h <= 0 {
+		return 80, 24
+	}
+	return w, h
+}
+
+func isTerminal() bool {
+	return readline.IsTerminal(int(os.Stdout.Fd())) && readline.IsTerminal(readline.GetStdin())
+}
+
+// show prints lines, through the pager when they do not fit in the terminal
+func show(lines []string) error {
+	_, h := terminalSize()
+	if !isTerminal() || len(lines) < h {
+		fmt.Println(strings.Join(lines, "\n"))
+		return nil
+	}
+	return page(lines)
+}
+
+// page displays lines one screen at a time until the user quits
+// space/f next page, b previous page, enter/j next line, k previous line, g/G top/bottom,
+// /pattern search forward, n/N next/previous match, q quit
+func page(lines []string) error {
+	fd := readline.GetStdin()
+	state, err := readline.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer readline.Restore(fd, state)
+
+	var (
+		top     int
+		pattern string
+		status  string
+		key     = make([]byte, 8)
+	)
+	for {
+		_, h := terminalSize()
+		rows := h - 1
+		if top > len(lines)-rows {
+			top = len(lines) - rows
+		}
+		if top < 0 {
+			top = 0
+		}
+		end := top + rows
+		if end > len(lines) {
+			end = len(lines)
+		}
+		fmt.Print("\033[H\033[2J")
+		for _, l := range lines[top:end] {
+			fmt.Print(l + "\r\n")
+		}
+		if status == "" {
+			status = fmt.Sprintf("lines %d-%d/%d", top+1, end, len(lines))
+			if end == len(lines) {
+				status += " (END)"
+			}
+		}
+		fmt.Print("\033[7m" + status + "\033[0m")
+		status = ""
+
+		n, err := os.Stdin.Read(key)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		switch k := string(key[:n]); k {
+		case "q", "Q", "\x03", "\x1b":
+			fmt.Print("\r\033[K")
+			return nil
+		case " ", "f", "\x1b[6~":
+			top += rows
+		case "b", "\x1b[5~":
+			top -= rows
+		case "\r", "\n", "j", "\x1b[B":
+			top++
+		case "k", "\x1b[A":
+			top--
+		case "g":
+			top = 0
+		case "G":
+			top = len(lines)
+		case "/":
+			fmt.Print("\r\033[K/")
+			pattern = readPattern()
+			fallthrough
+		case "n":
+			if i := searchLines(lines, pattern, top+1, 1); i >= 0 {
+				top = i
+			} else if pattern != "" {
+				status = "pattern not found: " + pattern
+			}
+		case "N":
+			if i := searchLines(lines, pattern, top-1, -1); i >= 0 {
+				top = i
+			} else if pattern != "" {
+				status = "pattern not found: " + pattern
+			}
+		}
+	}
+	return nil
+}
+
+// readPattern reads a search pattern echoing it in raw mode until enter
+func readPattern() string {
+	var b []byte
+	c := make([]byte, 1)
+	for {
+		if _, err := os.Stdin.Read(c); err != nil {
+			return string(b)
+		}
+		switch c[0] {
+		case '\r', '\n':
+			return string(b)
+		case 127, '\b':
+			if len(b) > 0 {
+				b = b[:len(b)-1]
+				fmt.Print("\b \b")
+			}
+		case 0x1b, 0x03:
+			return ""
+		default:
+			b = append(b, c[0])
+			os.Stdout.Write(c)
+		}
+	}
+}
+
+// searchLines returns the index of the first line from start, in direction step, containing pattern
+// The search ignores case and terminal styling
+func searchLines(lines []string, pattern string, start, step int) int {
+	if pattern == "" {
+		return -1
+	}
+	pattern = strings.ToLower(pattern)
+	for i := start; i >= 0 && i < len(lines); i += step {
+		if strings.Contains(strings.ToLower(ansiEscape.ReplaceAllString(lines[i], "")), pattern) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package cli
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+)
+
+// peerCred is not implemented outside of Linux
+func peerCred(conn *net.UnixConn) (PeerCred, error) {
+	return PeerCred{}, fmt.Errorf("peer credentials are not supported on %s", runtime.GOOS)
+}
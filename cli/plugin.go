@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/loicalleyne/cli/command"
+)
+
+// pluginDescribe is the flag a plugin is run with to describe itself
+const pluginDescribe = "--cli-describe"
+
+// pluginDescribeTimeout bounds the describe handshake so a misbehaving plugin cannot hang startup
+const pluginDescribeTimeout = 2 * time.Second
+
+// DiscoverPlugins adds a root command for every executable named <prefix>-<name> found in dirs, then on PATH
+// The first executable found for a name wins and names already taken by a command or a system command are
+// skipped. Each plugin is run once with --cli-describe and may print a JSON CommandSpec, without handler or
+// shell, to provide its help, args, flags and subcommands. Running the command runs the plugin with the
+// remaining args and the stdio of the Cli. A plugin that does not make a valid command, e.g. with a dot in
+// its name, is skipped and the others are still added, the error lists the skipped ones.
+func (cli *Cli) DiscoverPlugins(prefix string, dirs ...string) error {
+	dirs = append(dirs, filepath.SplitList(os.Getenv("PATH"))...)
+	taken := map[string]bool{}
+	for _, c := range systemCommands {
+		taken[c.Name] = true
+	}
+	for _, c := range cli.commands() {
+		for _, n := range append([]string{c.Name}, c.Aliases...) {
+			taken[n] = true
+		}
+	}
+	var skipped []string
+	for _, dir := range dirs {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			// PATH often lists directories that do not exist
+			continue
+		}
+		for _, f := range files {
+			name := pluginName(prefix, f)
+			if name == "" || taken[name] {
+				continue
+			}
+			taken[name] = true
+			if err := cli.AddCommand(describePlugin(name, filepath.Join(dir, f.Name()))); err != nil {
+				skipped = append(skipped, fmt.Sprintf("%s: %v", filepath.Join(dir, f.Name()), err))
+			}
+		}
+	}
+	if len(skipped) > 0 {
+		return fmt.Errorf("invalid plugins skipped: %s", strings.Join(skipped, "; "))
+	}
+	return nil
+}
+
+// pluginName returns the command name of f if it is an executable named <prefix>-<name>
+func pluginName(prefix string, f os.FileInfo) string {
+	if f.IsDir() || !strings.HasPrefix(f.Name(), prefix+"-") {
+		return ""
+	}
+	name := strings.TrimPrefix(f.Name(), prefix+"-")
+	if runtime.GOOS == "windows" {
+		if !strings.EqualFold(filepath.Ext(name), ".exe") {
+			return ""
+		}
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	} else if f.Mode()&0111 == 0 {
+		return ""
+	}
+	return name
+}
+
+// describePlugin returns the command running the plugin at path, described by its --cli-describe output
+func describePlugin(name, path string) command.Command {
+	spec := CommandSpec{Help: "plugin " + path}
+	ctx, cancel := context.WithTimeout(context.Background(), pluginDescribeTimeout)
+	defer cancel()
+	if out, err := exec.CommandContext(ctx, path, pluginDescribe).Output(); err == nil {
+		var described CommandSpec
+		if json.Unmarshal(out, &described) == nil {
+			spec = described
+		}
+	}
+	spec.Name = name
+	if spec.Category == "" {
+		spec.Category = "plugins"
+	}
+	return pluginCommand(spec, path, nil)
+}
+
+// pluginCommand converts spec to a command running the plugin at path with the path of the subcommand
+func pluginCommand(spec CommandSpec, path string, parents []string) command.Command {
+	c := command.Command{
+		Name:      spec.Name,
+		Aliases:   spec.Aliases,
+		Category:  spec.Category,
+		Usage:     spec.Usage,
+		Help:      spec.Help,
+		ManPage:   spec.ManPage,
+		Args:      spec.Args,
+		Flags:     spec.Flags,
+		Examples:  spec.Examples,
+		Dangerous: spec.Dangerous,
+		Handler: func(ctx context.Context, args []string) error {
+			cmd := exec.CommandContext(ctx, path, append(append([]string{}, parents...), args...)...)
+			setStdio(ctx, cmd)
+			return cmd.Run()
+		},
+	}
+	for _, s := range spec.SubCommands {
+		// the plugin itself is the root, its subcommands are passed as args
+		c.SubCommands = append(c.SubCommands, pluginCommand(s, path, append(append([]string{}, parents...), s.Name)))
+	}
+	return c
+}
@@ -0,0 +1,451 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/loicalleyne/cli/command"
+)
+
+var (
+	contextType  = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType    = reflect.TypeOf((*error)(nil)).Elem()
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// Register turns the exported methods of obj, a struct or a pointer to a struct, into the subcommands
+// of a root command and adds it to the Cli, see Reflect for how methods are mapped
+func (cli *Cli) Register(obj interface{}) error {
+	c, err := Reflect(obj)
+	if err != nil {
+		return err
+	}
+	return cli.AddCommand(c)
+}
+
+// Reflect builds a command from obj, a struct or a pointer to a struct
+//
+// The command is named after the type in lower case, GitHub becomes github unless a name tag says otherwise
+// as below, and each exported method whose results are nothing or a single error becomes a subcommand named
+// after the method in kebab case, ListRepos becomes list-repos.
+// An optional first context.Context parameter receives the context of the dispatch, the following
+// parameters are bound to args and flags. Supported types are strings, bools, integers, floats,
+// time.Duration and slices of those.
+//
+// Names come from tags on blank fields of the struct:
+//
+//	type GitHub struct {
+//		_ struct{} `name:"github" help:"github primary command interface"`
+//		_ struct{} `cli:"login <token> --scope" help:"log in with a token" aliases:"signin"`
+//	}
+//
+//	func (g *GitHub) Login(ctx context.Context, token string, scope []string) error
+//
+// maps Login to `github login <token> --scope scope`. In the cli tag <name> is a required arg,
+// [name] an optional one, name... a variadic one and --name a flag, matched to the parameters in order.
+// Untagged parameters become required args named arg1, arg2..., and untagged slices List flags named
+// the same way, e.g. --arg2, Go method names carry no parameter names. The final parameter of a variadic
+// method becomes a variadic arg.
+// A struct parameter maps its fields tagged arg:"name" or flag:"name" instead, with optional
+// short, help and default tags. A method tagged dangerous:"true" becomes a Dangerous command.
+func Reflect(obj interface{}) (command.Command, error) {
+	v := reflect.ValueOf(obj)
+	if !v.IsValid() {
+		return command.Command{}, fmt.Errorf("cli: cannot register nil, a struct or a pointer to a struct is required")
+	}
+	t := v.Type()
+	st := t
+	if st.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return command.Command{}, fmt.Errorf("cli: cannot register a nil %s", t)
+		}
+		st = st.Elem()
+	}
+	if st.Kind() != reflect.Struct {
+		return command.Command{}, fmt.Errorf("cli: cannot register %s, a struct or a pointer to a struct is required", t)
+	}
+
+	root := command.Command{Name: strings.ToLower(st.Name())}
+	tags := map[string]reflect.StructTag{}
+	for i := 0; i < st.NumField(); i++ {
+		f := st.Field(i)
+		if f.Name != "_" {
+			continue
+		}
+		if name := f.Tag.Get("name"); name != "" {
+			root.Name = name
+			root.Help = f.Tag.Get("help")
+			root.ManPage = f.Tag.Get("man")
+			root.Category = f.Tag.Get("category")
+			root.Aliases = splitList(f.Tag.Get("aliases"))
+		}
+		if spec := strings.Fields(f.Tag.Get("cli")); len(spec) > 0 {
+			tags[spec[0]] = f.Tag
+		}
+	}
+
+	for i := 0; i < t.NumMethod(); i++ {
+		m := t.Method(i)
+		tag, ok := tags[kebab(m.Name)]
+		if !ok {
+			tag = tags[strings.ToLower(m.Name)]
+		}
+		c, ok, err := methodCommand(v.Method(i), kebab(m.Name), tag)
+		if err != nil {
+			// untagged helper methods with parameters that cannot be mapped are not commands
+			if tag.Get("cli") == "" {
+				continue
+			}
+			return command.Command{}, fmt.Errorf("cli: %s.%s: %v", st.Name(), m.Name, err)
+		}
+		if ok {
+			root.SubCommands = append(root.SubCommands, c)
+		}
+	}
+	if len(root.SubCommands) == 0 {
+		return command.Command{}, fmt.Errorf("cli: %s has no exported method usable as a command", t)
+	}
+	return root, nil
+}
+
+// kebab converts a Go identifier to a command name, ListRepos becomes list-repos
+func kebab(s string) string {
+	var b strings.Builder
+	runes := []rune(s)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			// start a new word on a lower to upper transition or at the end of an acronym
+			if i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))) {
+				b.WriteRune('-')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func splitList(s string) []string {
+	var l []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			l = append(l, v)
+		}
+	}
+	return l
+}
+
+// binding ties a method parameter, or a field of a struct parameter, to an arg or a flag
+type binding struct {
+	name     string
+	flag     bool
+	required bool
+	variadic bool
+	typ      reflect.Type
+	def      string
+	help     string
+	short    string
+	// field is the index of the field in the struct parameter, nil for plain parameters
+	field []int
+}
+
+// specToken is a word of a cli tag after the method name
+type specToken struct {
+	name     string
+	flag     bool
+	required bool
+	variadic bool
+}
+
+func parseSpec(words []string) []specToken {
+	var tokens []specToken
+	for _, w := range words {
+		t := specToken{}
+		switch {
+		case strings.HasPrefix(strings.Trim(w, "[]"), "--"):
+			t.flag = true
+			t.name = strings.TrimPrefix(strings.Trim(w, "[]"), "--")
+		case strings.HasPrefix(w, "<"):
+			t.required = true
+			t.name = strings.Trim(w, "<>")
+		default:
+			t.name = strings.Trim(w, "[]")
+		}
+		if strings.HasSuffix(t.name, "...") {
+			t.variadic = true
+			t.name = strings.TrimSuffix(t.name, "...")
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens
+}
+
+func supported(t reflect.Type) bool {
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// typeName returns the placeholder shown for values of t in help
+func typeName(t reflect.Type) string {
+	if t == durationType {
+		return "duration"
+	}
+	if t.Kind() == reflect.Slice {
+		return typeName(t.Elem())
+	}
+	if t.Kind() == reflect.Bool {
+		return ""
+	}
+	return t.Kind().String()
+}
+
+// valueType returns the command.Type* describing values of t
+func valueType(t reflect.Type) string {
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return command.TypeBoolean
+	case reflect.Float32, reflect.Float64:
+		return command.TypeNumber
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if t != durationType {
+			return command.TypeInteger
+		}
+	}
+	return command.TypeString
+}
+
+// methodCommand builds the command calling method m, ok is false when the results of m cannot be mapped
+func methodCommand(m reflect.Value, name string, tag reflect.StructTag) (command.Command, bool, error) {
+	mt := m.Type()
+	if mt.NumOut() > 1 || (mt.NumOut() == 1 && mt.Out(0) != errorType) {
+		return command.Command{}, false, nil
+	}
+
+	c := command.Command{
+		Name:      name,
+		Help:      tag.Get("help"),
+		ManPage:   tag.Get("man"),
+		Dangerous: tag.Get("dangerous") == "true",
+		Category:  tag.Get("category"),
+		Aliases:   splitList(tag.Get("aliases")),
+	}
+	spec := parseSpec(strings.Fields(tag.Get("cli")))
+	if len(spec) > 0 {
+		spec = spec[1:]
+	}
+
+	first := 0
+	if mt.NumIn() > 0 && mt.In(0) == contextType {
+		first = 1
+	}
+	var bindings []binding
+	for i := first; i < mt.NumIn(); i++ {
+		pt := mt.In(i)
+		if pt.Kind() == reflect.Struct {
+			if i != mt.NumIn()-1 {
+				return c, false, fmt.Errorf("struct parameter must be the last one")
+			}
+			bs, err := structBindings(pt)
+			if err != nil {
+				return c, false, err
+			}
+			bindings = append(bindings, bs...)
+			continue
+		}
+		if !supported(pt) {
+			return c, false, fmt.Errorf("unsupported parameter type %s", pt)
+		}
+		b := binding{name: fmt.Sprintf("arg%d", i-first+1), required: true, typ: pt}
+		if n := i - first; n < len(spec) {
+			b.name, b.flag, b.required, b.variadic = spec[n].name, spec[n].flag, spec[n].required, spec[n].variadic
+		} else if pt.Kind() == reflect.Slice && mt.IsVariadic() && i == mt.NumIn()-1 {
+			b.required, b.variadic = false, true
+		} else if pt.Kind() == reflect.Slice {
+			b.required, b.flag = false, true
+		}
+		if b.variadic && pt.Kind() != reflect.Slice {
+			return c, false, fmt.Errorf("variadic arg %s must be a slice", b.name)
+		}
+		bindings = append(bindings, b)
+	}
+
+	for _, b := range bindings {
+		if b.flag {
+			c.Flags = append(c.Flags, command.Flag{Name: b.name, Short: b.short, Value: typeName(b.typ), Default: b.def, Help: b.help, Type: valueType(b.typ), List: b.typ.Kind() == reflect.Slice})
+		} else {
+			c.Args = append(c.Args, command.Arg{Name: b.name, Required: b.required, Variadic: b.variadic, Help: b.help, Type: valueType(b.typ)})
+		}
+	}
+
+	c.Handler = func(ctx context.Context, args []string) error {
+		positional, values, err := command.Parse(c.Flags, args)
+		if err != nil {
+			return err
+		}
+		in, err := bind(mt, first, bindings, positional, values)
+		if err != nil {
+			return err
+		}
+		if first == 1 {
+			in = append([]reflect.Value{reflect.ValueOf(ctx)}, in...)
+		}
+		var out []reflect.Value
+		if mt.IsVariadic() {
+			out = m.CallSlice(in)
+		} else {
+			out = m.Call(in)
+		}
+		if len(out) == 1 && !out[0].IsNil() {
+			return out[0].Interface().(error)
+		}
+		return nil
+	}
+	return c, true, nil
+}
+
+// structBindings maps the fields of a struct parameter tagged arg or flag
+func structBindings(t reflect.Type) ([]binding, error) {
+	var bindings []binding
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		b := binding{typ: f.Type, field: f.Index, def: f.Tag.Get("default"), help: f.Tag.Get("help")}
+		if name := f.Tag.Get("arg"); name != "" {
+			spec := parseSpec([]string{name})[0]
+			b.name, b.required, b.variadic = spec.name, !strings.HasPrefix(name, "["), spec.variadic
+		} else if name := f.Tag.Get("flag"); name != "" {
+			b.name, b.flag, b.short = name, true, f.Tag.Get("short")
+		} else {
+			continue
+		}
+		if !supported(f.Type) {
+			return nil, fmt.Errorf("unsupported field type %s for %s", f.Type, f.Name)
+		}
+		bindings = append(bindings, b)
+	}
+	return bindings, nil
+}
+
+// bind converts parsed args and flag values to the parameters of a method of type mt
+func bind(mt reflect.Type, first int, bindings []binding, positional []string, values map[string][]string) ([]reflect.Value, error) {
+	var in []reflect.Value
+	var st reflect.Value
+	for i := first; i < mt.NumIn(); i++ {
+		if pt := mt.In(i); pt.Kind() == reflect.Struct {
+			st = reflect.New(pt).Elem()
+		}
+	}
+
+	for _, b := range bindings {
+		var raw []string
+		switch {
+		case b.flag:
+			for _, v := range values[b.name] {
+				if b.typ.Kind() == reflect.Slice {
+					raw = append(raw, splitList(v)...)
+				} else {
+					raw = []string{v}
+				}
+			}
+			if len(raw) == 0 && b.def != "" {
+				raw = splitList(b.def)
+			}
+		case b.variadic:
+			raw, positional = positional, nil
+		case len(positional) > 0:
+			raw, positional = positional[:1], positional[1:]
+		case b.required:
+			return nil, fmt.Errorf("missing argument <%s>", b.name)
+		case b.def != "":
+			raw = []string{b.def}
+		}
+
+		v := reflect.New(b.typ).Elem()
+		if err := setValue(v, raw); err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %v", b.name, err)
+		}
+		if b.field != nil {
+			st.FieldByIndex(b.field).Set(v)
+		} else {
+			in = append(in, v)
+		}
+	}
+	if len(positional) > 0 {
+		return nil, fmt.Errorf("unexpected arguments %v", positional)
+	}
+	if st.IsValid() {
+		in = append(in, st)
+	}
+	return in, nil
+}
+
+// setValue stores raw, converted to the type of v, in v
+func setValue(v reflect.Value, raw []string) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	if v.Kind() == reflect.Slice {
+		s := reflect.MakeSlice(v.Type(), len(raw), len(raw))
+		for i, r := range raw {
+			if err := setValue(s.Index(i), []string{r}); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+	}
+	r := raw[0]
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(r)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(r)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(r)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(r, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(r, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(r, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/loicalleyne/cli/command"
+)
+
+// update replaces the list holding the command at path, names or aliases from the root, with the
+// result of fn. Every list along the path is copied so snapshots of the tree taken by readers are
+// never modified. Subcommands supplied by Dynamic are not part of the registry and cannot be updated
+func update(commands []command.Command, path []string, depth int, fn func(level []command.Command, index int) ([]command.Command, error)) ([]command.Command, error) {
+	index := -1
+	for j := range commands {
+		if commands[j].HasName(path[depth]) {
+			index = j
+			break
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("unknown command %q", strings.Join(path[:depth+1], " "))
+	}
+	if depth == len(path)-1 {
+		return fn(commands, index)
+	}
+	subs, err := update(commands[index].SubCommands, path, depth+1, fn)
+	if err != nil {
+		return nil, err
+	}
+	copied := append([]command.Command{}, commands...)
+	copied[index].SubCommands = subs
+	return copied, nil
+}
+
+// updateTree applies fn to the list holding the command at path and installs the new tree
+func (cli *Cli) updateTree(path []string, fn func(level []command.Command, index int) ([]command.Command, error)) error {
+	if len(path) == 0 {
+		return fmt.Errorf("empty command path")
+	}
+	cli.mu.Lock()
+	defer cli.mu.Unlock()
+	commands, err := update(cli.Commands, path, 0, fn)
+	if err != nil {
+		return err
+	}
+	cli.Commands = commands
+	cli.index = CommandIndex{}
+	return nil
+}
+
+// RemoveCommand removes the command at path, e.g. RemoveCommand("github", "login")
+// Help and completion stop offering it immediately
+func (cli *Cli) RemoveCommand(path ...string) error {
+	return cli.updateTree(path, func(level []command.Command, index int) ([]command.Command, error) {
+		if len(path) == 1 {
+			delete(cli.mounts, level[index].Name)
+		}
+		commands := make([]command.Command, 0, len(level)-1)
+		commands = append(commands, level[:index]...)
+		return append(commands, level[index+1:]...), nil
+	})
+}
+
+// ReplaceCommand replaces the command at path with i, the replacement is validated against the siblings it joins
+func (cli *Cli) ReplaceCommand(i command.ICommand, path ...string) error {
+	c := command.From(i)
+	return cli.updateTree(path, func(level []command.Command, index int) ([]command.Command, error) {
+		seen := map[string]bool{}
+		for j, sibling := range level {
+			if j == index {
+				continue
+			}
+			for _, n := range append([]string{sibling.Name}, sibling.Aliases...) {
+				seen[n] = true
+			}
+		}
+		if errs := validateTree([]command.Command{c}, path[:len(path)-1], seen); len(errs) > 0 {
+			return nil, errs[0]
+		}
+		if len(path) == 1 {
+			delete(cli.mounts, level[index].Name)
+		}
+		commands := append([]command.Command{}, level...)
+		commands[index] = c
+		return commands, nil
+	})
+}
+
+// Mount adds a root command named prefix whose subcommands are the root commands of other
+// The mount is live: commands later added to or removed from other are reflected under prefix. Mounting
+// a Cli that already has cli mounted under it, at any depth, is refused since the tree would be infinite.
+func (cli *Cli) Mount(prefix string, other *Cli) error {
+	if other == cli {
+		return fmt.Errorf("%q: a Cli cannot be mounted on itself", prefix)
+	}
+	// mounts are serialized so two Clis mounted on each other concurrently cannot both pass the check
+	mountMu.Lock()
+	defer mountMu.Unlock()
+	if other.reaches(cli) {
+		return fmt.Errorf("%q: mounting would create a cycle, the Cli is mounted under the one being mounted", prefix)
+	}
+	err := cli.AddCommand(command.Command{
+		Name: prefix,
+		Help: fmt.Sprintf("%s commands", prefix),
+		Dynamic: func() []command.Command {
+			return other.commands()
+		},
+	})
+	if err != nil {
+		return err
+	}
+	cli.mu.Lock()
+	if cli.mounts == nil {
+		cli.mounts = map[string]*Cli{}
+	}
+	cli.mounts[prefix] = other
+	cli.mu.Unlock()
+	return nil
+}
+
+// mountMu serializes Mount across Clis
+var mountMu sync.Mutex
+
+// reaches reports whether target is cli or is mounted under it, directly or through other mounts
+func (cli *Cli) reaches(target *Cli) bool {
+	seen := map[*Cli]bool{}
+	pending := []*Cli{cli}
+	for len(pending) > 0 {
+		c := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if c == target {
+			return true
+		}
+		if seen[c] {
+			continue
+		}
+		seen[c] = true
+		// one Cli is locked at a time so concurrent mounts cannot deadlock
+		c.mu.RLock()
+		for _, m := range c.mounts {
+			pending = append(pending, m)
+		}
+		c.mu.RUnlock()
+	}
+	return false
+}
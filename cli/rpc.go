@@ -0,0 +1,317 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/loicalleyne/cli/command"
+)
+
+// JSON-RPC 2.0 error codes
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcCommandFailed  = -32000
+)
+
+// rpcList is the method returning the Schemas of the commands, JSON-RPC 2.0 reserves the methods starting
+// with rpcPrefix to the server, so it never shadows a command
+const (
+	rpcPrefix = "rpc."
+	rpcList   = rpcPrefix + "list"
+)
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// rpcResult is the result of a command call
+type rpcResult struct {
+	Output string `json:"output"`
+}
+
+// Serve answers JSON-RPC 2.0 requests on the connections accepted by l until ctx is done, Run returns or l fails
+// Methods are dotted command paths, e.g. "github.login", and "rpc.list" returns the Schemas of the commands.
+// Methods starting with "rpc." are reserved by JSON-RPC 2.0, so Serve refuses to start when a root command
+// is named rpc.
+// Params are either an array of raw args or an object mapping arg and flag names to values as described
+// by ParamsSchema. The result holds the output the command wrote to Output(ctx), a failed command
+// returns its error with the output as data. Calls run concurrently, and a command calling os.Exit stops the server.
+// l is typically a Unix socket or a localhost TCP listener, Serve does no authentication.
+func (cli *Cli) Serve(ctx context.Context, l net.Listener) error {
+	for _, c := range cli.commands() {
+		if c.HasName(strings.TrimSuffix(rpcPrefix, ".")) {
+			return fmt.Errorf("serve: the methods of the %q command are reserved by JSON-RPC", c.Name)
+		}
+	}
+	return cli.serve(ctx, l, cli.serveConn)
+}
+
+// serve runs handle for every connection accepted by l until ctx is done, Run returns or l fails
+// l and the open connections are closed when it stops, and it returns nil unless l failed.
+func (cli *Cli) serve(ctx context.Context, l net.Listener, handle func(ctx context.Context, conn net.Conn)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// the hook is removed once the server stops, a program serving again does not accumulate them
+	defer cli.onShutdown(func() error {
+		cancel()
+		return nil
+	})()
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go func() {
+			done := make(chan struct{})
+			defer close(done)
+			go func() {
+				select {
+				case <-ctx.Done():
+					conn.Close()
+				case <-done:
+				}
+			}()
+			handle(ctx, conn)
+		}()
+	}
+}
+
+// serveConn answers the requests of conn, one JSON value per request or batch
+func (cli *Cli) serveConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	dec := json.NewDecoder(conn)
+	enc := json.NewEncoder(conn)
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			if err != io.EOF {
+				enc.Encode(rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{Code: rpcParseError, Message: err.Error()}})
+			}
+			return
+		}
+		if reply := cli.rpcHandle(ctx, raw); reply != nil {
+			if err := enc.Encode(reply); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// rpcHandle answers a request or a batch, it returns nil when no response is due
+func (cli *Cli) rpcHandle(ctx context.Context, raw json.RawMessage) interface{} {
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(raw, &batch); err != nil || len(batch) == 0 {
+			return rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{Code: rpcInvalidRequest, Message: "invalid batch"}}
+		}
+		var replies []rpcResponse
+		for _, r := range batch {
+			if reply := cli.rpcCall(ctx, r); reply != nil {
+				replies = append(replies, *reply)
+			}
+		}
+		if len(replies) == 0 {
+			return nil
+		}
+		return replies
+	}
+	if reply := cli.rpcCall(ctx, raw); reply != nil {
+		return *reply
+	}
+	return nil
+}
+
+// rpcCall answers a single request, it returns nil for notifications
+func (cli *Cli) rpcCall(ctx context.Context, raw json.RawMessage) *rpcResponse {
+	var req rpcRequest
+	if err := json.Unmarshal(raw, &req); err != nil || req.JSONRPC != "2.0" || req.Method == "" {
+		return &rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{Code: rpcInvalidRequest, Message: "invalid request"}}
+	}
+	result, rpcErr := cli.rpcDispatch(ctx, req)
+	if len(req.ID) == 0 {
+		return nil
+	}
+	return &rpcResponse{JSONRPC: "2.0", ID: req.ID, Result: result, Error: rpcErr}
+}
+
+func (cli *Cli) rpcDispatch(ctx context.Context, req rpcRequest) (interface{}, *rpcError) {
+	if strings.HasPrefix(req.Method, rpcPrefix) {
+		if req.Method != rpcList {
+			return nil, &rpcError{Code: rpcMethodNotFound, Message: fmt.Sprintf("unknown method %q", req.Method)}
+		}
+		// an empty tree is still a result
+		return append([]CommandSchema{}, cli.Schemas()...), nil
+	}
+	c, ok := cli.Lookup(req.Method)
+	if !ok {
+		return nil, &rpcError{Code: rpcMethodNotFound, Message: fmt.Sprintf("unknown command %q", req.Method)}
+	}
+	if !c.Runnable() {
+		return nil, &rpcError{Code: rpcMethodNotFound, Message: fmt.Sprintf("%s: nothing to run", req.Method)}
+	}
+	args, err := paramsArgs(c, req.Params)
+	if err != nil {
+		return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+	}
+	if err := cli.unlock(true); err != nil {
+		return nil, &rpcError{Code: rpcCommandFailed, Message: err.Error()}
+	}
+	output, err := captureOutput(ctx, func(ctx context.Context) error {
+		return c.Run(ctx, args)
+	})
+	if err != nil {
+		return nil, &rpcError{Code: rpcCommandFailed, Message: err.Error(), Data: rpcResult{Output: output}}
+	}
+	return rpcResult{Output: output}, nil
+}
+
+// paramsArgs converts JSON-RPC params to the args of c
+// An array is used as is, an object maps arg and flag names to values, flags come first
+func paramsArgs(c command.Command, params json.RawMessage) ([]string, error) {
+	if trimmed := bytes.TrimSpace(params); len(trimmed) == 0 || string(trimmed) == "null" {
+		params = json.RawMessage("{}")
+	} else if trimmed[0] == '[' {
+		var args []string
+		if err := json.Unmarshal(params, &args); err != nil {
+			return nil, fmt.Errorf("params must be an array of strings or an object")
+		}
+		return args, nil
+	}
+	var named map[string]json.RawMessage
+	if err := json.Unmarshal(params, &named); err != nil {
+		return nil, fmt.Errorf("params must be an array of strings or an object")
+	}
+
+	var args, positional []string
+	used := map[string]bool{}
+	for _, f := range c.Flags {
+		raw, ok := named[f.Name]
+		if !ok {
+			continue
+		}
+		used[f.Name] = true
+		values, err := paramValues(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f.Name, err)
+		}
+		for _, v := range values {
+			if err := f.Check(v); err != nil {
+				return nil, err
+			}
+			if f.ValueType() == command.TypeBoolean && f.Value == "" && v == "false" {
+				continue
+			}
+			args = append(args, "--"+f.Name+"="+v)
+		}
+	}
+	skipped := ""
+	for _, a := range c.Args {
+		raw, ok := named[a.Name]
+		if !ok {
+			if a.Required {
+				return nil, fmt.Errorf("missing argument %s", a.Name)
+			}
+			if skipped == "" {
+				skipped = a.Name
+			}
+			continue
+		}
+		if skipped != "" {
+			// args are positional, a later one cannot be placed without the ones before it
+			return nil, fmt.Errorf("%s needs %s", a.Name, skipped)
+		}
+		used[a.Name] = true
+		values, err := paramValues(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", a.Name, err)
+		}
+		if !a.Variadic && len(values) != 1 {
+			return nil, fmt.Errorf("%s: expected a single value", a.Name)
+		}
+		for _, v := range values {
+			if err := a.Check(v); err != nil {
+				return nil, err
+			}
+		}
+		positional = append(positional, values...)
+	}
+	for name := range named {
+		if !used[name] {
+			return nil, fmt.Errorf("unknown param %q", name)
+		}
+	}
+	for _, p := range positional {
+		if strings.HasPrefix(p, "-") {
+			// keep positional values starting with a dash from being parsed as flags
+			args = append(args, "--")
+			break
+		}
+	}
+	return append(args, positional...), nil
+}
+
+// paramValues returns the string forms of a JSON scalar or array of scalars
+func paramValues(raw json.RawMessage) ([]string, error) {
+	var list []json.RawMessage
+	if err := json.Unmarshal(raw, &list); err != nil {
+		list = []json.RawMessage{raw}
+	}
+	values := make([]string, 0, len(list))
+	for _, item := range list {
+		var v interface{}
+		dec := json.NewDecoder(bytes.NewReader(item))
+		dec.UseNumber()
+		if err := dec.Decode(&v); err != nil {
+			return nil, err
+		}
+		switch v := v.(type) {
+		case string:
+			values = append(values, v)
+		case json.Number:
+			values = append(values, v.String())
+		case bool:
+			values = append(values, fmt.Sprint(v))
+		default:
+			return nil, fmt.Errorf("expected a string, number or boolean")
+		}
+	}
+	return values, nil
+}
+
+// captureOutput runs fn with a context whose Output is a buffer and returns what fn wrote to it
+func captureOutput(ctx context.Context, fn func(ctx context.Context) error) (string, error) {
+	var out outputBuffer
+	err := fn(command.WithOutput(ctx, &out))
+	return out.String(), err
+}
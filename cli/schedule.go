@@ -0,0 +1,303 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// scheduleHistory is the number of runs kept for every schedule
+const scheduleHistory = 20
+
+// scheduled is a command line run on a cron schedule
+type scheduled struct {
+	ID      int           `json:"id"`
+	Cron    string        `json:"cron"`
+	Command string        `json:"command"`
+	Runs    []scheduleRun `json:"runs,omitempty"`
+	spec    CronSchedule
+	running bool
+}
+
+// scheduleRun is a run of a schedule, Status is ok or the error of the command
+type scheduleRun struct {
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+	Status   string        `json:"status"`
+}
+
+// scheduleFile is the format schedules are persisted in
+type scheduleFile struct {
+	Schedules []*scheduled `json:"schedules"`
+}
+
+// scheduler holds the schedules of a Cli, its own mutex keeps runs from contending with the command tree
+type scheduler struct {
+	mu      sync.Mutex
+	entries []*scheduled
+	last    int
+	path    string
+}
+
+// SetScheduleFile persists the schedules and their run history to the JSON file at path
+// The schedules in the file, if it exists, replace the current ones. The file is rewritten whenever a
+// schedule is added or removed and after every run. Loading schedules does not run them, they run while
+// RunSchedules does, e.g. while Run serves the REPL.
+func (cli *Cli) SetScheduleFile(path string) error {
+	s := &cli.schedules
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		var f scheduleFile
+		if err := json.Unmarshal(b, &f); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		last := 0
+		for _, e := range f.Schedules {
+			if e.spec, err = ParseCron(e.Cron); err != nil {
+				return fmt.Errorf("%s: schedule %d: %v", path, e.ID, err)
+			}
+			if e.ID > last {
+				last = e.ID
+			}
+		}
+		s.entries, s.last = f.Schedules, last
+	}
+	s.path = path
+	return s.save()
+}
+
+// save writes the schedules to the schedule file, if any, it is called with mu held
+func (s *scheduler) save() error {
+	if s.path == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(scheduleFile{Schedules: s.entries}, "", "  ")
+	if err != nil {
+		return err
+	}
+	// a crash while writing must not lose the previous schedules
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// RunSchedules runs the schedules due at every time received from ticks until ctx is done or ticks is closed
+// A nil ticks receives the start of every minute. Run calls it while the REPL runs, programs without a
+// REPL, e.g. only serving sessions with ServeSSH, call it themselves.
+func (cli *Cli) RunSchedules(ctx context.Context, ticks <-chan time.Time) {
+	if ticks == nil {
+		ticks = minuteTicks(ctx)
+	}
+	for {
+		var now time.Time
+		select {
+		case <-ctx.Done():
+			return
+		case t, ok := <-ticks:
+			if !ok {
+				return
+			}
+			now = t
+		}
+		s := &cli.schedules
+		s.mu.Lock()
+		for _, e := range s.entries {
+			// a run still going on when the schedule is due again is not doubled
+			if e.spec.Matches(now) && !e.running {
+				e.running = true
+				go cli.runScheduled(ctx, e)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// minuteTicks sends the start of every minute until ctx is done
+func minuteTicks(ctx context.Context) <-chan time.Time {
+	ticks := make(chan time.Time)
+	go func() {
+		for {
+			next := time.Now().Truncate(time.Minute).Add(time.Minute)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Until(next)):
+			}
+			select {
+			case ticks <- next:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ticks
+}
+
+// runScheduled runs e in a session of its own and records the run
+// Only failures are notified, the output of scheduled commands is discarded.
+func (cli *Cli) runScheduled(ctx context.Context, e *scheduled) {
+	rs := &Session{Prompt: cli.prompt(), Vars: map[string]string{}, cli: cli, out: ioutil.Discard, remote: true}
+	start := time.Now()
+	err := cli.unlock(true)
+	if err == nil {
+		err = cli.findCommand(rs.context(ctx), e.Command)
+	}
+	run := scheduleRun{Start: start, Duration: time.Since(start), Status: "ok"}
+	if err != nil && err != errExit {
+		run.Status = err.Error()
+		cli.NotifyLevel(LevelError, fmt.Sprintf("schedule %d: %s: %v", e.ID, e.Command, err))
+	}
+
+	s := &cli.schedules
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.running = false
+	e.Runs = append(e.Runs, run)
+	if len(e.Runs) > scheduleHistory {
+		e.Runs = e.Runs[len(e.Runs)-scheduleHistory:]
+	}
+	if err := s.save(); err != nil {
+		cli.NotifyLevel(LevelError, fmt.Sprintf("schedule: %v", err))
+	}
+}
+
+// schedule implements the schedule command
+func (cli *Cli) schedule(w io.Writer, args []string) error {
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+	s := &cli.schedules
+	switch args[0] {
+	case "add":
+		expr, line, err := splitCron(args[1:])
+		if err != nil {
+			return err
+		}
+		spec, err := ParseCron(expr)
+		if err != nil {
+			return err
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		e := &scheduled{ID: s.last + 1, Cron: expr, Command: line, spec: spec}
+		s.entries = append(s.entries, e)
+		if err := s.save(); err != nil {
+			// a schedule that would not survive a restart is not added
+			s.entries = s.entries[:len(s.entries)-1]
+			return fmt.Errorf("schedule: %v", err)
+		}
+		s.last = e.ID
+		fmt.Fprintf(w, "[%d] %s next at %s\n", e.ID, line, formatNext(spec.Next(time.Now())))
+		return nil
+	case "list":
+		var b bytes.Buffer
+		tw := tabwriter.NewWriter(&b, 0, 4, 3, ' ', 0)
+		fmt.Fprintf(tw, "ID\tCRON\tCOMMAND\tNEXT\tLAST\n")
+		s.mu.Lock()
+		for _, e := range s.entries {
+			last := "-"
+			if n := len(e.Runs); n > 0 {
+				last = e.Runs[n-1].Status
+			}
+			if e.running {
+				last = "running"
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", e.ID, e.Cron, e.Command, formatNext(e.spec.Next(time.Now())), last)
+		}
+		s.mu.Unlock()
+		tw.Flush()
+		_, err := w.Write(b.Bytes())
+		return err
+	case "rm":
+		if len(args) != 2 {
+			return fmt.Errorf("schedule: usage: schedule rm <id>")
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("schedule: invalid id %q", args[1])
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for i, e := range s.entries {
+			if e.ID == id {
+				entries := s.entries
+				s.entries = append(entries[:i:i], entries[i+1:]...)
+				if err := s.save(); err != nil {
+					s.entries = entries
+					return fmt.Errorf("schedule: %v", err)
+				}
+				return nil
+			}
+		}
+		return fmt.Errorf("schedule: no schedule %d", id)
+	case "history":
+		var b bytes.Buffer
+		tw := tabwriter.NewWriter(&b, 0, 4, 3, ' ', 0)
+		fmt.Fprintf(tw, "ID\tSTART\tDURATION\tSTATUS\n")
+		s.mu.Lock()
+		for _, e := range s.entries {
+			if len(args) > 1 && strconv.Itoa(e.ID) != args[1] {
+				continue
+			}
+			for _, r := range e.Runs {
+				fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", e.ID, r.Start.Format("2006-01-02 15:04:05"), r.Duration.Round(time.Millisecond), r.Status)
+			}
+		}
+		s.mu.Unlock()
+		tw.Flush()
+		_, err := w.Write(b.Bytes())
+		return err
+	}
+	return fmt.Errorf("schedule: unknown subcommand %q, see help schedule", args[0])
+}
+
+// splitCron splits the args of schedule add into the cron expression and the command line
+// The expression is either quoted, a descriptor such as @daily or the first 5 args.
+func splitCron(args []string) (string, string, error) {
+	n := 5
+	switch {
+	case len(args) > 0 && (strings.HasPrefix(args[0], `"`) || strings.HasPrefix(args[0], "'")):
+		quote := args[0][:1]
+		n = 0
+		for i, a := range args {
+			if (i > 0 || len(a) > 1) && strings.HasSuffix(a, quote) {
+				n = i + 1
+				break
+			}
+		}
+		if n == 0 {
+			return "", "", fmt.Errorf("schedule: unterminated %s in cron expression", quote)
+		}
+	case len(args) > 0 && strings.HasPrefix(args[0], "@"):
+		n = 1
+	}
+	if len(args) <= n {
+		return "", "", fmt.Errorf("schedule: usage: schedule add <cron expression> <command...>")
+	}
+	expr := strings.Trim(strings.Join(args[:n], " "), `"'`)
+	return expr, strings.Join(args[n:], " "), nil
+}
+
+// formatNext formats the next run of a schedule
+func formatNext(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.Format("2006-01-02 15:04")
+}
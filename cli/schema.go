@@ -0,0 +1,127 @@
+package cli
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/loicalleyne/cli/command"
+)
+
+// schemaDialect is the JSON Schema version of the generated schemas
+const schemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema is a JSON Schema, limited to the keywords needed to describe commands
+type Schema struct {
+	Dialect              string             `json:"$schema,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Default              interface{}        `json:"default,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+}
+
+// CommandSchema describes a command of the tree for tool integrations
+type CommandSchema struct {
+	// Path is the dotted path of the command, as accepted by Lookup and Invoke
+	Path     string `json:"path"`
+	Help     string `json:"help,omitempty"`
+	Runnable bool   `json:"runnable"`
+	// Dangerous commands should only be run by integrations configured to allow them, the subcommands of a
+	// Dangerous command are Dangerous too
+	Dangerous bool `json:"dangerous,omitempty"`
+	// Params is the schema of the object mapping arg and flag names to their values
+	Params *Schema `json:"params"`
+}
+
+// ParamsSchema returns the schema of the params of c: an object with a property per arg and flag
+// Variadic args and List flags are arrays of their type
+func ParamsSchema(c command.Command) *Schema {
+	closed := false
+	s := &Schema{Dialect: schemaDialect, Type: "object", Properties: map[string]*Schema{}, AdditionalProperties: &closed}
+	for _, f := range c.Flags {
+		p := &Schema{Type: f.ValueType(), Description: f.Help, Enum: f.Enum}
+		if f.Default != "" {
+			p.Default = typedDefault(f.ValueType(), f.Default)
+		}
+		if f.List {
+			p = &Schema{Type: "array", Description: f.Help, Items: &Schema{Type: f.ValueType(), Enum: f.Enum}}
+			if f.Default != "" {
+				var defaults []interface{}
+				for _, v := range splitList(f.Default) {
+					defaults = append(defaults, typedDefault(f.ValueType(), v))
+				}
+				p.Default = defaults
+			}
+		}
+		s.Properties[f.Name] = p
+	}
+	// args are set last so an arg wins over a flag of the same name
+	for _, a := range c.Args {
+		p := &Schema{Type: a.ValueType(), Description: a.Help, Enum: a.Enum}
+		if a.Variadic {
+			p = &Schema{Type: "array", Description: a.Help, Items: &Schema{Type: a.ValueType(), Enum: a.Enum}}
+		}
+		s.Properties[a.Name] = p
+		if a.Required {
+			s.Required = append(s.Required, a.Name)
+		}
+	}
+	return s
+}
+
+// typedDefault converts the default value of a flag to its JSON type
+func typedDefault(typ, value string) interface{} {
+	switch typ {
+	case command.TypeInteger:
+		if n, err := strconv.ParseInt(value, 0, 64); err == nil {
+			return n
+		}
+	case command.TypeNumber:
+		if n, err := strconv.ParseFloat(value, 64); err == nil {
+			return n
+		}
+	case command.TypeBoolean:
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return value
+}
+
+// Schemas returns the description of every command of the tree, depth first
+func (cli *Cli) Schemas() []CommandSchema {
+	var schemas []CommandSchema
+	var walk func(commands []command.Command, parents []string, dangerous bool)
+	walk = func(commands []command.Command, parents []string, dangerous bool) {
+		for _, c := range commands {
+			if c.Name == "." {
+				continue
+			}
+			path := append(append([]string{}, parents...), c.Name)
+			schemas = append(schemas, CommandSchema{
+				Path:      strings.Join(path, "."),
+				Help:      c.Help,
+				Runnable:  c.Runnable(),
+				Dangerous: dangerous || c.Dangerous,
+				Params:    ParamsSchema(c),
+			})
+			walk(c.AllSubCommands(), path, dangerous || c.Dangerous)
+		}
+	}
+	walk(cli.commands(), nil, false)
+	return schemas
+}
+
+// WriteSchema writes the description of every command as an indented JSON document to w, {"commands": [...]}
+func (cli *Cli) WriteSchema(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Commands []CommandSchema `json:"commands"`
+	}{cli.Schemas()})
+}
@@ -0,0 +1,303 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chzyer/readline"
+	"github.com/fatih/color"
+	"github.com/loicalleyne/cli/command"
+)
+
+// errExit is returned by the exit command, it ends the session running it instead of the process
+var errExit = errors.New("exit")
+
+type sessionKey struct{}
+
+// Session is an interactive loop reading command lines and dispatching them to the commands of a Cli
+// Every session has its own line editing state, history, variables and prompt, so several sessions
+// can share one command tree, e.g. one per remote connection
+type Session struct {
+	// Prompt is shown before every line
+	Prompt string
+	// Vars are set with the set command and expanded in input as $name or ${name}, text naming no variable
+	// is left as typed
+	Vars map[string]string
+	// LastInteraction is the time the last line was read
+	LastInteraction time.Time
+	Scanner         *readline.Instance
+
+	cli *Cli
+	out io.Writer
+	// remote sessions do not own the process stdio, commands write to out through Output(ctx)
+	remote bool
+	// jobs are the commands started with &, numbered from lastJob
+	jobsMu  sync.Mutex
+	jobs    []*job
+	lastJob int
+	// notifyMu serializes notices printed by other goroutines
+	notifyMu sync.Mutex
+}
+
+// SessionFrom returns the session running the command of ctx, nil outside of a session
+func SessionFrom(ctx context.Context) *Session {
+	s, _ := ctx.Value(sessionKey{}).(*Session)
+	return s
+}
+
+// Output returns the writer a command running with ctx should write to: the output of its session,
+// of the JSON-RPC or tool call running it, or os.Stdout. It is the same as command.Output.
+func Output(ctx context.Context) io.Writer {
+	return command.Output(ctx)
+}
+
+// context returns a copy of ctx in which commands run in s and write to its output
+func (s *Session) context(ctx context.Context) context.Context {
+	return command.WithOutput(context.WithValue(ctx, sessionKey{}, s), s.out)
+}
+
+// prompt returns the prompt of the Cli, used as the initial prompt of new sessions
+func (cli *Cli) prompt() string {
+	if s := cli.scanner(); s != nil {
+		return s.Config.Prompt
+	}
+	return ">>> "
+}
+
+// localSession returns the session on the process stdio, using the readline instance of the Cli
+func (cli *Cli) localSession() *Session {
+	return &Session{
+		Prompt:  cli.prompt(),
+		Vars:    map[string]string{},
+		Scanner: cli.scanner(),
+		cli:     cli,
+		out:     os.Stdout,
+	}
+}
+
+// NewSession returns a session reading from in and writing to out, typically a network connection whose
+// client terminal is in raw mode: line editing, history and completion are done by the session
+// width returns the width of the client terminal, nil means 80 columns
+// History is kept in memory for the lifetime of the session
+func (cli *Cli) NewSession(in io.ReadCloser, out io.Writer, width func() int) (*Session, error) {
+	if width == nil {
+		width = func() int { return 80 }
+	}
+	s := &Session{
+		Prompt: cli.prompt(),
+		Vars:   map[string]string{},
+		cli:    cli,
+		out:    &crlfWriter{out},
+		remote: true,
+	}
+	noop := func() error { return nil }
+	l, err := readline.NewEx(&readline.Config{
+		Prompt:              s.Prompt,
+		AutoComplete:        &readlineCompleter{cli},
+		InterruptPrompt:     "^C",
+		EOFPrompt:           "exit",
+		HistorySearchFold:   true,
+		FuncFilterInputRune: filterInput,
+		Stdin:               in,
+		Stdout:              s.out,
+		Stderr:              s.out,
+		ForceUseInteractive: true,
+		FuncIsTerminal:      func() bool { return true },
+		FuncMakeRaw:         noop,
+		FuncExitRaw:         noop,
+		FuncGetWidth:        width,
+		FuncOnWidthChanged:  func(func()) {},
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.Scanner = l
+	return s, nil
+}
+
+// Run reads and dispatches lines until the exit command, the end of input or the cancellation of ctx
+func (s *Session) Run(ctx context.Context) error {
+	s.cli.attach(s)
+	defer s.cli.detach(s)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !s.remote {
+			// the terminal may have been handed over with Suspend
+			if err := s.cli.waitResumed(ctx); err != nil {
+				return err
+			}
+		}
+		s.Scanner.SetPrompt(s.Prompt)
+		line, err := s.Scanner.Readline()
+		if err == readline.ErrInterrupt {
+			continue
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		s.LastInteraction = time.Now()
+		s.cli.touch(s.LastInteraction)
+
+		err = s.Exec(ctx, line)
+		if err == errExit {
+			return nil
+		}
+		if err != nil {
+			fmt.Fprintln(s.out, color.RedString(err.Error()))
+		}
+	}
+}
+
+// Exec runs line as if typed in the session, after expanding the session variables
+func (s *Session) Exec(ctx context.Context, line string) error {
+	ctx = s.context(ctx)
+	line = s.expand(line)
+	// a vault locked by the idle timeout is unlocked before anything but exit runs
+	if fields := strings.Fields(line); len(fields) > 0 && fields[0] != "exit" {
+		if err := s.cli.unlock(s.remote); err != nil {
+			return err
+		}
+	}
+	// only a word of its own is the background marker, an arg may end with &
+	if fields := strings.Fields(line); len(fields) > 0 && fields[len(fields)-1] == "&" {
+		return s.background(ctx, strings.TrimSuffix(strings.TrimSpace(line), "&"))
+	}
+	// the vault is not locked under a running command
+	defer s.cli.running()()
+	if s.remote {
+		return s.cli.findCommand(ctx, line)
+	}
+	// Ctrl-C cancels the command, not the session
+	cctx, cancel := s.cli.foreground(ctx)
+	defer cancel()
+	err := s.cli.findCommand(cctx, line)
+	if err == context.Canceled && cctx.Err() != nil && ctx.Err() == nil {
+		return nil
+	}
+	return err
+}
+
+// Close releases the line editor of the session and closes its input
+func (s *Session) Close() error {
+	if s.Scanner == nil {
+		return nil
+	}
+	return s.Scanner.Close()
+}
+
+// expand replaces $name and ${name} in line with the values of the session variables
+// References to unknown variables, an unclosed ${ and a $ followed by no name are left as typed.
+func (s *Session) expand(line string) string {
+	var b strings.Builder
+	for i := 0; i < len(line); i++ {
+		if line[i] != '$' {
+			b.WriteByte(line[i])
+			continue
+		}
+		var name string
+		end := i + 1
+		if strings.HasPrefix(line[end:], "{") {
+			if n := strings.IndexByte(line[end:], '}'); n > 0 {
+				name, end = line[end+1:end+n], end+n+1
+			}
+		} else {
+			for end < len(line) && isNameByte(line[end]) {
+				end++
+			}
+			name = line[i+1 : end]
+		}
+		v, ok := s.Vars[name]
+		if name == "" || !ok {
+			b.WriteByte('$')
+			continue
+		}
+		b.WriteString(v)
+		i = end - 1
+	}
+	return b.String()
+}
+
+// isNameByte reports whether c may be part of a variable name
+func isNameByte(c byte) bool {
+	return c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// set implements the set command: no args lists the variables, a name alone removes it
+func (s *Session) set(args []string) error {
+	switch len(args) {
+	case 0:
+		names := make([]string, 0, len(s.Vars))
+		for name := range s.Vars {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		tw := tabwriter.NewWriter(s.out, 0, 4, 3, ' ', 0)
+		for _, name := range names {
+			fmt.Fprintf(tw, "%s\t%s\n", name, s.Vars[name])
+		}
+		return tw.Flush()
+	case 1:
+		delete(s.Vars, args[0])
+	default:
+		s.Vars[args[0]] = strings.Join(args[1:], " ")
+	}
+	return nil
+}
+
+// outputBuffer buffers what a command writes, e.g. a background job until fg attaches it to its session
+type outputBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+	w   io.Writer
+}
+
+func (o *outputBuffer) Write(b []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.w != nil {
+		return o.w.Write(b)
+	}
+	return o.buf.Write(b)
+}
+
+// attach writes the buffered output to w and sends the rest straight to it
+func (o *outputBuffer) attach(w io.Writer) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	w.Write(o.buf.Bytes())
+	o.buf.Reset()
+	o.w = w
+}
+
+// String returns the buffered output
+func (o *outputBuffer) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.String()
+}
+
+// crlfWriter turns \n into \r\n for clients whose terminal is in raw mode and does not return the carriage
+type crlfWriter struct {
+	w io.Writer
+}
+
+func (c *crlfWriter) Write(b []byte) (int, error) {
+	if _, err := c.w.Write(bytes.Replace(b, []byte("\n"), []byte("\r\n"), -1)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
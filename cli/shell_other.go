@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package cli
+
+import (
+	"context"
+	"os/exec"
+)
+
+// shellQuote quotes s for the shell running command templates
+func shellQuote(s string) string {
+	return shQuote(s)
+}
+
+// shellCommand returns the command running script with sh -c
+func shellCommand(ctx context.Context, script string) *exec.Cmd {
+	return exec.CommandContext(ctx, "sh", "-c", script)
+}
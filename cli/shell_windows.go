@@ -0,0 +1,59 @@
+//go:build windows
+// +build windows
+
+package cli
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// shellQuote quotes s for the shell running command templates
+func shellQuote(s string) string {
+	return cmdQuote(s)
+}
+
+// cmdQuote quotes s as a single argument of a program started by cmd.exe
+// s is first quoted for CommandLineToArgvW, then every cmd.exe metacharacter, quotes included,
+// is escaped with a caret so that cmd.exe passes the quoted argument through unchanged
+func cmdQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	slashes := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			slashes++
+		case '"':
+			// backslashes before a quote are doubled and the quote escaped
+			b.WriteString(strings.Repeat(`\`, slashes+1))
+			slashes = 0
+		default:
+			slashes = 0
+		}
+		b.WriteByte(s[i])
+	}
+	// backslashes before the closing quote are doubled
+	b.WriteString(strings.Repeat(`\`, slashes))
+	b.WriteByte('"')
+
+	var escaped strings.Builder
+	for _, r := range b.String() {
+		if strings.ContainsRune(`()%!^"<>&|`, r) {
+			escaped.WriteByte('^')
+		}
+		escaped.WriteRune(r)
+	}
+	return escaped.String()
+}
+
+// shellCommand returns the command running script with cmd /S /C
+// The command line is set as is, the default quoting of exec is meant for programs parsing it
+// with CommandLineToArgvW and would mangle the carets and quotes cmd.exe relies on
+func shellCommand(ctx context.Context, script string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "cmd")
+	cmd.SysProcAttr = &syscall.SysProcAttr{CmdLine: `cmd /S /C "` + script + `"`}
+	return cmd
+}
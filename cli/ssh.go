@@ -0,0 +1,147 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync/atomic"
+
+	"github.com/fatih/color"
+	"golang.org/x/crypto/ssh"
+)
+
+// ServeSSH runs a session for every SSH shell opened on the connections accepted by l until ctx is done,
+// Run returns or l fails, closing the open connections when it stops.
+// config authenticates clients, see AuthorizedKeys, and must hold a host key. An exec request, e.g.
+// ssh host github login, runs a single command line and returns its exit status instead of a session
+func (cli *Cli) ServeSSH(ctx context.Context, l net.Listener, config *ssh.ServerConfig) error {
+	return cli.serve(ctx, l, func(ctx context.Context, conn net.Conn) {
+		cli.serveSSHConn(ctx, conn, config)
+	})
+}
+
+func (cli *Cli) serveSSHConn(ctx context.Context, conn net.Conn, config *ssh.ServerConfig) {
+	sconn, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	defer sconn.Close()
+	go ssh.DiscardRequests(requests)
+	for nc := range channels {
+		if nc.ChannelType() != "session" {
+			nc.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		ch, requests, err := nc.Accept()
+		if err != nil {
+			continue
+		}
+		go cli.serveSSHChannel(ctx, ch, requests)
+	}
+}
+
+// serveSSHChannel answers the requests of a session channel until the client closes it
+// The commands started from the channel, e.g. background jobs, are cancelled when it closes.
+func (cli *Cli) serveSSHChannel(ctx context.Context, ch ssh.Channel, requests <-chan *ssh.Request) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer ch.Close()
+	width := int32(80)
+	started := false
+	for req := range requests {
+		switch req.Type {
+		case "pty-req":
+			var pty struct {
+				Term                         string
+				Columns, Rows, Width, Height uint32
+				Modes                        string
+			}
+			if ssh.Unmarshal(req.Payload, &pty) == nil && pty.Columns > 0 {
+				atomic.StoreInt32(&width, int32(pty.Columns))
+			}
+			req.Reply(true, nil)
+		case "window-change":
+			var size struct{ Columns, Rows, Width, Height uint32 }
+			if ssh.Unmarshal(req.Payload, &size) == nil && size.Columns > 0 {
+				atomic.StoreInt32(&width, int32(size.Columns))
+			}
+			req.Reply(true, nil)
+		case "shell":
+			if started {
+				req.Reply(false, nil)
+				continue
+			}
+			started = true
+			req.Reply(true, nil)
+			go func() {
+				s, err := cli.NewSession(ch, ch, func() int { return int(atomic.LoadInt32(&width)) })
+				if err == nil {
+					err = s.Run(ctx)
+					s.Close()
+				}
+				exitSSH(ch, err)
+			}()
+		case "exec":
+			var exec struct{ Command string }
+			if started || ssh.Unmarshal(req.Payload, &exec) != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			started = true
+			req.Reply(true, nil)
+			go func() {
+				s := &Session{Vars: map[string]string{}, cli: cli, out: ch, remote: true}
+				err := s.Exec(ctx, exec.Command)
+				if err == errExit {
+					err = nil
+				}
+				if err != nil {
+					fmt.Fprintln(ch.Stderr(), color.RedString(err.Error()))
+				}
+				exitSSH(ch, err)
+			}()
+		default:
+			req.Reply(false, nil)
+		}
+	}
+}
+
+// exitSSH reports the exit status of a shell or exec request and closes the channel
+func exitSSH(ch ssh.Channel, err error) {
+	status := struct{ Status uint32 }{}
+	if err != nil {
+		status.Status = 1
+	}
+	ch.SendRequest("exit-status", false, ssh.Marshal(&status))
+	ch.Close()
+}
+
+// AuthorizedKeys returns a PublicKeyCallback for ssh.ServerConfig accepting the keys of the
+// authorized_keys file at path
+func AuthorizedKeys(path string) (func(ssh.ConnMetadata, ssh.PublicKey) (*ssh.Permissions, error), error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	keys := map[string]bool{}
+	for i, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, i+1, err)
+		}
+		keys[string(key.Marshal())] = true
+	}
+	return func(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+		if keys[string(key.Marshal())] {
+			return &ssh.Permissions{Extensions: map[string]string{"pubkey-fp": ssh.FingerprintSHA256(key)}}, nil
+		}
+		return nil, fmt.Errorf("unknown public key for %q", meta.User())
+	}, nil
+}
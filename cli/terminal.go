@@ -0,0 +1,155 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/chzyer/readline"
+)
+
+// WithTerminal hands the process terminal to fn, e.g. to run an editor, a pager or a child shell with
+// os.Stdin and os.Stdout, and gives it back to the REPL when fn returns, whatever fn left it in.
+// The REPL only reads the terminal while it prompts, so a command calling WithTerminal finds it in
+// cooked mode, and it is put back in the state it had before fn ran. While fn runs, SIGINT is left to
+// fn and its children instead of cancelling the command. Calls may be nested, e.g. by a watched command showing a manpage.
+// WithTerminal is meant for commands run from the local REPL or unattended, remote sessions have no
+// access to the process terminal.
+func (cli *Cli) WithTerminal(fn func() error) error {
+	cli.handOff()
+	defer cli.takeBack()
+
+	fd := readline.GetStdin()
+	if readline.IsTerminal(fd) {
+		if state, err := readline.GetState(fd); err == nil {
+			defer readline.Restore(fd, state)
+		}
+	}
+	return fn()
+}
+
+// handOff stops Run from handling SIGINT until the matching takeBack
+func (cli *Cli) handOff() {
+	cli.term.Lock()
+	defer cli.term.Unlock()
+	cli.handoff++
+	if cli.handoff > 1 || cli.interrupts == nil {
+		return
+	}
+	// a channel of our own keeps SIGINT from killing the process when fn does not handle it
+	cli.ignored = make(chan os.Signal, 1)
+	signal.Notify(cli.ignored, os.Interrupt)
+	signal.Stop(cli.interrupts)
+}
+
+// takeBack lets Run handle SIGINT again once the last WithTerminal func has returned
+func (cli *Cli) takeBack() {
+	cli.term.Lock()
+	defer cli.term.Unlock()
+	cli.handoff--
+	if cli.handoff > 0 || cli.ignored == nil {
+		return
+	}
+	if cli.interrupts != nil {
+		signal.Notify(cli.interrupts, os.Interrupt)
+	}
+	signal.Stop(cli.ignored)
+	cli.ignored = nil
+}
+
+// foreground returns a copy of ctx cancelled by SIGINT, for a command run from the REPL, and the func
+// releasing it once the command returns
+func (cli *Cli) foreground(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	cli.term.Lock()
+	previous := cli.interrupt
+	cli.interrupt = cancel
+	cli.term.Unlock()
+	return ctx, func() {
+		cli.term.Lock()
+		cli.interrupt = previous
+		cli.term.Unlock()
+		cancel()
+	}
+}
+
+// interruptCommand cancels the command running in the foreground of the REPL, if any
+func (cli *Cli) interruptCommand() {
+	cli.term.Lock()
+	defer cli.term.Unlock()
+	if cli.interrupt != nil {
+		cli.interrupt()
+	}
+}
+
+// runFunc counts a command only setting Func as running until the returned func is called
+func (cli *Cli) runFunc() func() {
+	cli.term.Lock()
+	cli.funcs++
+	cli.term.Unlock()
+	return func() {
+		cli.term.Lock()
+		cli.funcs--
+		cli.term.Unlock()
+	}
+}
+
+// interruptFunc runs the shutdown hooks and exits the process when a command only setting Func is running,
+// a Func cannot be cancelled and would keep Run from returning
+func (cli *Cli) interruptFunc() {
+	cli.term.Lock()
+	funcs := cli.funcs
+	cli.term.Unlock()
+	if funcs == 0 {
+		return
+	}
+	cli.shutdown()
+	os.Exit(130)
+}
+
+// handingOff reports whether a WithTerminal func is running
+func (cli *Cli) handingOff() bool {
+	cli.term.Lock()
+	defer cli.term.Unlock()
+	return cli.handoff > 0
+}
+
+// Suspend holds the REPL before its next prompt until Resume is called, leaving the terminal to another
+// part of the program, e.g. a goroutine running a child process. Commands should prefer WithTerminal,
+// which does not need a second goroutine.
+func (cli *Cli) Suspend() {
+	cli.mu.Lock()
+	defer cli.mu.Unlock()
+	if cli.resumed == nil {
+		cli.resumed = make(chan struct{})
+	}
+	cli.LastInteraction = time.Time{}
+}
+
+// Resume lets the REPL held by Suspend prompt again, it does nothing when the REPL is not suspended
+func (cli *Cli) Resume() {
+	cli.mu.Lock()
+	defer cli.mu.Unlock()
+	if cli.resumed != nil {
+		close(cli.resumed)
+		cli.resumed = nil
+	}
+	cli.LastInteraction = time.Now()
+}
+
+// waitResumed blocks while the REPL is suspended, it returns the error of ctx if it ends first
+func (cli *Cli) waitResumed(ctx context.Context) error {
+	cli.mu.RLock()
+	resumed := cli.resumed
+	cli.mu.RUnlock()
+	if resumed == nil {
+		return nil
+	}
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,213 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/loicalleyne/cli/command"
+)
+
+// toolsCommand is the hidden first argument serving the commands as tools on stdin and stdout,
+// e.g. myapp __tools vault.delete, the following args are the dangerous commands to allow
+const toolsCommand = "__tools"
+
+// toolsProtocolVersion is the Model Context Protocol revision spoken by ServeTools
+const toolsProtocolVersion = "2024-11-05"
+
+// tool is a command as listed by tools/list
+type tool struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description,omitempty"`
+	InputSchema *Schema `json:"inputSchema"`
+}
+
+// toolContent is a block of the result of tools/call
+type toolContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type toolResult struct {
+	Content []toolContent `json:"content"`
+	IsError bool          `json:"isError"`
+}
+
+// toolName returns the tool name of the command at the dotted path, tool names cannot hold dots
+func toolName(path string) string {
+	return strings.Replace(path, ".", "_", -1)
+}
+
+// ServeTools speaks a Model Context Protocol style JSON-RPC 2.0 tool protocol, one message per line,
+// on r and w until r ends or ctx is done. Tool calls run with ctx, once it is done r is no longer read,
+// a read still blocked on r is abandoned, and ServeTools returns nil. Every runnable command is a tool named by its path joined with underscores,
+// e.g. github_login, whose input schema is its ParamsSchema. A call returns what the command wrote to
+// Output(ctx), commands only setting Func print to the process stdout, w in the __tools mode of Run,
+// so they are neither listed nor callable. Dangerous commands and their subcommands are neither listed nor callable unless their
+// dotted path, or the path of one of their parents, is in allow. Commands whose tool names collide,
+// e.g. a.b and a_b, are left out since a call could not tell them apart.
+func (cli *Cli) ServeTools(ctx context.Context, r io.Reader, w io.Writer, allow ...string) error {
+	allowed := map[string]bool{}
+	for _, path := range allow {
+		allowed[path] = true
+	}
+	requests := readRequests(ctx, r)
+	enc := json.NewEncoder(w)
+	for {
+		var next decodedRequest
+		select {
+		case <-ctx.Done():
+			return nil
+		case next = <-requests:
+		}
+		req, err := next.req, next.err
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			enc.Encode(rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{Code: rpcParseError, Message: err.Error()}})
+			return err
+		}
+		result, rpcErr := cli.toolsDispatch(ctx, req, allowed)
+		if len(req.ID) == 0 {
+			continue
+		}
+		if err := enc.Encode(rpcResponse{JSONRPC: "2.0", ID: req.ID, Result: result, Error: rpcErr}); err != nil {
+			return err
+		}
+	}
+}
+
+// decodedRequest is a request read by readRequests, or the error ending the input
+type decodedRequest struct {
+	req rpcRequest
+	err error
+}
+
+// readRequests decodes the requests of r until it fails or ctx is done
+// Reads cannot be interrupted, the one blocked when ctx is done only returns with r.
+func readRequests(ctx context.Context, r io.Reader) <-chan decodedRequest {
+	requests := make(chan decodedRequest)
+	go func() {
+		dec := json.NewDecoder(r)
+		for {
+			var next decodedRequest
+			next.err = dec.Decode(&next.req)
+			select {
+			case requests <- next:
+			case <-ctx.Done():
+				return
+			}
+			if next.err != nil {
+				return
+			}
+		}
+	}()
+	return requests
+}
+
+// tools returns the commands offered as tools and the paths of the commands by tool name, more than one
+// for the names that collide, which are not offered, commands printing to stdout are not offered either
+func (cli *Cli) tools(allowed map[string]bool) ([]tool, map[string][]string) {
+	var offered []tool
+	paths := map[string][]string{}
+	for _, s := range cli.Schemas() {
+		if !s.Runnable || (s.Dangerous && !isAllowed(allowed, s.Path)) {
+			continue
+		}
+		name := toolName(s.Path)
+		paths[name] = append(paths[name], s.Path)
+		if c, ok := cli.Lookup(s.Path); ok && c.PrintsToStdout() {
+			continue
+		}
+		offered = append(offered, tool{Name: name, Description: s.Help, InputSchema: s.Params})
+	}
+	var tools []tool
+	for _, t := range offered {
+		if len(paths[t.Name]) == 1 {
+			tools = append(tools, t)
+		}
+	}
+	return tools, paths
+}
+
+// isAllowed reports whether the dotted path or one of its parents is in allowed
+func isAllowed(allowed map[string]bool, path string) bool {
+	for {
+		if allowed[path] {
+			return true
+		}
+		i := strings.LastIndex(path, ".")
+		if i < 0 {
+			return false
+		}
+		path = path[:i]
+	}
+}
+
+func (cli *Cli) toolsDispatch(ctx context.Context, req rpcRequest, allowed map[string]bool) (interface{}, *rpcError) {
+	switch req.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"protocolVersion": toolsProtocolVersion,
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+			"serverInfo":      map[string]string{"name": filepath.Base(os.Args[0]), "version": "1.0.0"},
+		}, nil
+	case "ping":
+		return map[string]interface{}{}, nil
+	case "tools/list":
+		tools, _ := cli.tools(allowed)
+		return map[string]interface{}{"tools": append([]tool{}, tools...)}, nil
+	case "tools/call":
+		var params struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+		}
+		_, paths := cli.tools(allowed)
+		matches := paths[params.Name]
+		if len(matches) == 0 {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: fmt.Sprintf("unknown tool %q", params.Name)}
+		}
+		if len(matches) > 1 {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: fmt.Sprintf("ambiguous tool %q, it names %s", params.Name, strings.Join(matches, " and "))}
+		}
+		c, ok := cli.Lookup(matches[0])
+		if !ok {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: fmt.Sprintf("unknown tool %q", params.Name)}
+		}
+		if c.PrintsToStdout() {
+			// it would write over the replies
+			return nil, &rpcError{Code: rpcInvalidParams, Message: fmt.Sprintf("%s: %v", params.Name, command.ErrStdout)}
+		}
+		if err := cli.unlock(true); err != nil {
+			return toolResult{Content: []toolContent{{Type: "text", Text: err.Error()}}, IsError: true}, nil
+		}
+		return callTool(ctx, c, params.Arguments), nil
+	}
+	if strings.HasPrefix(req.Method, "notifications/") {
+		return nil, nil
+	}
+	return nil, &rpcError{Code: rpcMethodNotFound, Message: fmt.Sprintf("unknown method %q", req.Method)}
+}
+
+// callTool runs c with arguments and reports failures in the result, as tool errors are meant for the model
+func callTool(ctx context.Context, c command.Command, arguments json.RawMessage) toolResult {
+	args, err := paramsArgs(c, arguments)
+	if err != nil {
+		return toolResult{Content: []toolContent{{Type: "text", Text: err.Error()}}, IsError: true}
+	}
+	output, err := captureOutput(ctx, func(ctx context.Context) error {
+		return c.Run(ctx, args)
+	})
+	if err != nil {
+		output += err.Error()
+	}
+	return toolResult{Content: []toolContent{{Type: "text", Text: output}}, IsError: err != nil}
+}
@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+)
+
+// PeerCred holds the credentials of the process at the other end of a Unix socket
+type PeerCred struct {
+	PID int32
+	UID uint32
+	GID uint32
+}
+
+// SameUser allows the peers running as the user of the process
+func SameUser(c PeerCred) bool {
+	return c.UID == uint32(os.Getuid())
+}
+
+// ServeUnix runs a session for every connection accepted by l whose peer credentials pass allow, until ctx
+// is done, Run returns or l fails, closing the open connections when it stops.
+// Peer credentials are only available on Linux, elsewhere every connection is refused.
+// Clients need a raw terminal, e.g. socat -,raw,echo=0 UNIX-CONNECT:/path/to/socket
+func (cli *Cli) ServeUnix(ctx context.Context, l *net.UnixListener, allow func(PeerCred) bool) error {
+	return cli.serve(ctx, l, func(ctx context.Context, conn net.Conn) {
+		cli.serveUnixConn(ctx, conn.(*net.UnixConn), allow)
+	})
+}
+
+func (cli *Cli) serveUnixConn(ctx context.Context, conn *net.UnixConn, allow func(PeerCred) bool) {
+	// the commands started from the session, e.g. background jobs, end with it
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer conn.Close()
+	cred, err := peerCred(conn)
+	if err != nil || !allow(cred) {
+		fmt.Fprint(conn, "permission denied\r\n")
+		return
+	}
+	s, err := cli.NewSession(conn, conn, nil)
+	if err != nil {
+		return
+	}
+	defer s.Close()
+	s.Run(ctx)
+}
@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/loicalleyne/cli/command"
+)
+
+func isSystemCommand(name string) bool {
+	for _, s := range systemCommands {
+		if s.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func commandPath(path []string, name string) string {
+	return strings.TrimSpace(strings.Join(append(append([]string{}, path...), name), " "))
+}
+
+// validateName checks a single command name and its aliases against its siblings
+func validateName(c command.Command, path []string, seen map[string]bool) error {
+	if c.Name == "" {
+		if len(path) == 0 {
+			return fmt.Errorf("command name cannot be empty")
+		}
+		return fmt.Errorf("%s: subcommand name cannot be empty", strings.Join(path, " "))
+	}
+	for _, name := range append([]string{c.Name}, c.Aliases...) {
+		if name == "" {
+			return fmt.Errorf("%q: alias cannot be empty", commandPath(path, c.Name))
+		}
+		if strings.IndexFunc(name, unicode.IsSpace) >= 0 {
+			return fmt.Errorf("%q: command name cannot contain whitespace", commandPath(path, name))
+		}
+		// dots separate the names of dotted paths, "." alone is the hidden command help skips
+		if name != "." && strings.Contains(name, ".") {
+			return fmt.Errorf("%q: command name cannot contain a dot", commandPath(path, name))
+		}
+		if len(path) == 0 && isSystemCommand(name) {
+			return fmt.Errorf("%q: command name clashes with system command", name)
+		}
+		if seen[name] {
+			return fmt.Errorf("%q: duplicate command name", commandPath(path, name))
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// validateTree walks commands and returns every structural problem found
+// seen holds the names already registered at this level
+// Dynamic subcommands are not called, they may depend on state only available at dispatch time
+// and are validated when a lookup walks through them
+func validateTree(commands []command.Command, path []string, seen map[string]bool) []error {
+	var errs []error
+	for _, c := range commands {
+		if err := validateName(c, path, seen); err != nil {
+			errs = append(errs, err)
+		}
+		if len(c.SubCommands) > 0 {
+			errs = append(errs, validateTree(c.SubCommands, append(path, c.Name), map[string]bool{})...)
+		}
+	}
+	return errs
+}
+
+// ValidateCommand checks c and its whole subtree for empty names, names containing
+// whitespace or dots, duplicate siblings and root names clashing with system commands
+// It returns the first problem found or nil
+func ValidateCommand(c command.Command) error {
+	if errs := validateTree([]command.Command{c}, nil, map[string]bool{}); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// Lint reports every problem in the registered command tree
+// On top of the checks done by AddCommand it flags commands without Help text or ManPage entries
+// It is intended to be called from tests
+func Lint(cli *Cli) []error {
+	commands := cli.commands()
+	errs := validateTree(commands, nil, map[string]bool{})
+	return append(errs, lintDocs(commands, nil)...)
+}
+
+func lintDocs(commands []command.Command, path []string) []error {
+	var errs []error
+	for _, c := range commands {
+		if c.Name == "" {
+			continue
+		}
+		p := commandPath(path, c.Name)
+		if strings.TrimSpace(c.Help) == "" {
+			errs = append(errs, fmt.Errorf("%q: missing help text", p))
+		}
+		if strings.TrimSpace(c.ManPage) == "" {
+			errs = append(errs, fmt.Errorf("%q: missing manpage", p))
+		}
+		if subs := c.AllSubCommands(); len(subs) > 0 {
+			errs = append(errs, lintDocs(subs, append(path, c.Name))...)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// watchInterval is the interval of watch without -n, watchMinInterval the shortest one accepted
+const (
+	watchInterval    = 2 * time.Second
+	watchMinInterval = 100 * time.Millisecond
+)
+
+var changed = color.New(color.ReverseVideo).SprintFunc()
+
+// watch implements the watch command: it runs a command line on an interval, showing its latest output
+// It stops when ctx is done, e.g. on Ctrl-C in the REPL. Remote sessions and background jobs cannot
+// interrupt a command, so watch is refused there, and so are commands only setting Func, whose output
+// could not be redrawn.
+func (cli *Cli) watch(ctx context.Context, args []string) error {
+	if session := SessionFrom(ctx); session != nil && session.remote {
+		return fmt.Errorf("watch: only available in the terminal, it cannot be interrupted here")
+	}
+	interval := watchInterval
+	if len(args) > 0 && strings.HasPrefix(args[0], "-n") {
+		value := strings.TrimPrefix(args[0], "-n")
+		args = args[1:]
+		if value == "" && len(args) > 0 {
+			value, args = args[0], args[1:]
+		}
+		d, err := parseInterval(value)
+		if err != nil {
+			return err
+		}
+		interval = d
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("watch: usage: watch [-n interval] <command...>")
+	}
+	if args[0] == "watch" {
+		return fmt.Errorf("watch: cannot watch watch")
+	}
+	line := strings.Join(args, " ")
+	// the output of every run is captured to be redrawn
+	if err := cli.checkCaptured(line); err != nil {
+		return fmt.Errorf("watch: %w", err)
+	}
+
+	return cli.watchLoop(ctx, SessionFrom(ctx), line, interval)
+}
+
+// parseInterval parses a duration such as 5s or 500ms, a bare number is a number of seconds
+func parseInterval(value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		seconds, ferr := strconv.ParseFloat(value, 64)
+		if ferr != nil {
+			return 0, fmt.Errorf("watch: invalid interval %q", value)
+		}
+		d = time.Duration(seconds * float64(time.Second))
+	}
+	if d < watchMinInterval {
+		return 0, fmt.Errorf("watch: interval %q is shorter than %s", value, watchMinInterval)
+	}
+	return d, nil
+}
+
+// watchLoop runs line every interval until ctx is done, highlighting the lines that changed since the last run
+func (cli *Cli) watchLoop(ctx context.Context, session *Session, line string, interval time.Duration) error {
+	w := Output(ctx)
+	var previous []string
+	for {
+		output, err := cli.watchOnce(ctx, session, line)
+		if ctx.Err() != nil {
+			// the run was interrupted, its output is partial
+			return nil
+		}
+		status := color.GreenString("ok")
+		if err != nil {
+			status = color.RedString("error: %v", err)
+		}
+		lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+
+		fmt.Fprint(w, "\033[H\033[2J")
+		fmt.Fprintf(w, "%s   %s   %s\n\n", heading(fmt.Sprintf("Every %s: %s", interval, line)), time.Now().Format("2006-01-02 15:04:05"), status)
+		for i, l := range lines {
+			if previous != nil && (i >= len(previous) || previous[i] != l) {
+				l = changed(l)
+			}
+			fmt.Fprintln(w, l)
+		}
+		previous = lines
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// watchOnce runs line through findCommand and returns what it wrote
+func (cli *Cli) watchOnce(ctx context.Context, session *Session, line string) (string, error) {
+	ws := &Session{Prompt: cli.prompt(), Vars: map[string]string{}, cli: cli, remote: true}
+	if session != nil {
+		ws.Vars = session.Vars
+	}
+	var out outputBuffer
+	ws.out = &out
+	err := cli.findCommand(ws.context(ctx), line)
+	return out.String(), err
+}
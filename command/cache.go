@@ -0,0 +1,25 @@
+package command
+
+import (
+	"sync"
+	"time"
+)
+
+// Cached returns a Dynamic func calling fn at most once every ttl and returning the last result in between
+// A zero ttl calls fn once
+func Cached(ttl time.Duration, fn func() []Command) func() []Command {
+	var (
+		mu      sync.Mutex
+		cached  []Command
+		fetched time.Time
+	)
+	return func() []Command {
+		mu.Lock()
+		defer mu.Unlock()
+		if fetched.IsZero() || (ttl > 0 && time.Since(fetched) >= ttl) {
+			cached = fn()
+			fetched = time.Now()
+		}
+		return cached
+	}
+}
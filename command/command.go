@@ -1,13 +1,50 @@
 package command
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
 // Command structure is composed of the function to route too plus information
 // Subcommands can also be nested
 type Command struct {
-	Name        string
-	Help        string
-	ManPage     string
-	Func        func(args []string)
+	Name string
+	// Aliases are alternative names the command can be invoked with
+	Aliases []string
+	// Category groups the command with its siblings in help output
+	Category string
+	// Usage overrides the generated synopsis shown after the command path, e.g. "<token> [--scope scope]"
+	Usage    string
+	Help     string
+	ManPage  string
+	Args     []Arg
+	Flags    []Flag
+	Examples []Example
+	// Dangerous commands, e.g. deleting data, are only offered to automated callers that allow them explicitly
+	Dangerous bool
+	// Func writes to os.Stdout, the process terminal, so a command only setting Func is refused where
+	// its output is captured: remote sessions, background jobs, watch, schedules, JSON-RPC and tool calls,
+	// use Out or Handler for commands offered there
+	Func func(args []string)
+	// Out is used instead of Func when set, it writes to w, the output of the session or call running
+	// the command, see Output
+	Out func(w io.Writer, args []string)
+	// Handler is used instead of Out and Func when set, it receives the context of the dispatch
+	// and its error is reported to the user, it writes to Output(ctx)
+	Handler func(ctx context.Context, args []string) error
+	// Complete returns candidates for the positional args of the command, it is used by the
+	// readline completer and the generated shell completion scripts
+	// args are the words typed after the command, the last one being the word to complete
+	Complete    func(args []string) []string
 	SubCommands []Command
+	// Dynamic supplies more subcommands, it is called every time the children of the command are
+	// needed by dispatch, completion and help, e.g. to list one subcommand per configured server
+	// Wrap it with Cached to reuse its result
+	Dynamic func() []Command
 }
 
 // NewCommand is the struct initialization for a command
@@ -19,6 +56,107 @@ func NewCommand() *Command {
 }
 
 // Count the number of subcommands
-func (c *Command) Count() int {
-	return len(c.SubCommands)
+func (c Command) Count() int {
+	return len(c.AllSubCommands())
+}
+
+// AllSubCommands returns SubCommands followed by the subcommands supplied by Dynamic
+func (c Command) AllSubCommands() []Command {
+	if c.Dynamic == nil {
+		return c.SubCommands
+	}
+	return append(append([]Command{}, c.SubCommands...), c.Dynamic()...)
+}
+
+// HasName reports whether name is the command name or one of its aliases
+func (c Command) HasName(name string) bool {
+	if c.Name == name {
+		return true
+	}
+	for _, a := range c.Aliases {
+		if a == name {
+			return true
+		}
+	}
+	return false
+}
+
+// UsageLine returns the synopsis of the command prefixed by path, the space separated command path
+// The synopsis is Usage when set, otherwise it is generated from Flags, Args and subcommands
+func (c Command) UsageLine(path string) string {
+	if c.Usage != "" {
+		return path + " " + c.Usage
+	}
+	parts := []string{path}
+	if len(c.SubCommands) > 0 || c.Dynamic != nil {
+		parts = append(parts, "<command>")
+	}
+	if len(c.Flags) > 0 {
+		parts = append(parts, "[flags]")
+	}
+	for _, a := range c.Args {
+		parts = append(parts, a.Synopsis())
+	}
+	return strings.Join(parts, " ")
+}
+
+// Info returns the name and documentation of the command
+func (c Command) Info() Info {
+	return Info{
+		Name:      c.Name,
+		Aliases:   c.Aliases,
+		Category:  c.Category,
+		Usage:     c.Usage,
+		Help:      c.Help,
+		ManPage:   c.ManPage,
+		Args:      c.Args,
+		Flags:     c.Flags,
+		Examples:  c.Examples,
+		Dangerous: c.Dangerous,
+	}
+}
+
+// Children returns the subcommands
+func (c Command) Children() []ICommand {
+	subs := c.AllSubCommands()
+	children := make([]ICommand, 0, len(subs))
+	for _, s := range subs {
+		children = append(children, s)
+	}
+	return children
+}
+
+// Runnable reports whether the command has a Handler, an Out or a Func to run
+func (c Command) Runnable() bool {
+	return c.Handler != nil || c.Out != nil || c.Func != nil
+}
+
+// PrintsToStdout reports whether Func is the only thing to run, it prints to the process stdout
+// instead of Output(ctx)
+func (c Command) PrintsToStdout() bool {
+	return c.Handler == nil && c.Out == nil && c.Func != nil
+}
+
+// ErrStdout is wrapped by the error of running a command printing to the process stdout where its output
+// is captured
+var ErrStdout = errors.New("prints to the terminal with Func, its output cannot be captured here, give it Out or Handler")
+
+// Run calls Handler, Out with Output(ctx) or Func, the first one set
+// A command only setting Func is refused with ErrStdout when Output(ctx) is not os.Stdout
+func (c Command) Run(ctx context.Context, args []string) error {
+	if c.Handler != nil {
+		return c.Handler(ctx, args)
+	}
+	if c.Out != nil {
+		c.Out(Output(ctx), args)
+		return nil
+	}
+	if c.Func != nil {
+		if Output(ctx) != os.Stdout {
+			return fmt.Errorf("%s: %w", c.Name, ErrStdout)
+		}
+		c.Func(args)
+		return nil
+	}
+	return fmt.Errorf("%s: nothing to run", c.Name)
 }
@@ -0,0 +1,213 @@
+package command
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Arg describes a positional argument of a command
+type Arg struct {
+	Name     string
+	Help     string
+	Required bool
+	// Variadic args consume all remaining positional arguments and must come last
+	Variadic bool
+	// Type is the type of the value, see TypeString, empty means TypeString
+	Type string
+	// Enum lists the accepted values when not empty
+	Enum []string
+}
+
+// Value types of args and flags, used to validate values and to describe commands to other tools
+const (
+	TypeString  = "string"
+	TypeInteger = "integer"
+	TypeNumber  = "number"
+	TypeBoolean = "boolean"
+)
+
+// Synopsis returns the arg as shown in usage lines, <name> when required and [name] otherwise
+func (a Arg) Synopsis() string {
+	s := a.Name
+	if a.Variadic {
+		s += "..."
+	}
+	if a.Required {
+		return "<" + s + ">"
+	}
+	return "[" + s + "]"
+}
+
+// Flag describes a --name or -short option of a command
+type Flag struct {
+	Name  string
+	Short string
+	Help  string
+	// Value is the placeholder shown for the flag value, empty for boolean flags
+	Value   string
+	Default string
+	// Type is the type of the value, see TypeString, empty means TypeBoolean
+	// for flags without a Value placeholder and TypeString otherwise
+	Type string
+	// Enum lists the accepted values when not empty
+	Enum []string
+	// List flags take comma separated values, each of them matching Type and Enum
+	List bool
+}
+
+// Synopsis returns the flag as shown in help output, e.g. "-s, --scope string"
+func (f Flag) Synopsis() string {
+	s := "    --" + f.Name
+	if f.Short != "" {
+		s = "-" + f.Short + ", --" + f.Name
+	}
+	if f.Value != "" {
+		s += " " + f.Value
+	}
+	return s
+}
+
+// ValueType returns the type of the arg value
+func (a Arg) ValueType() string {
+	if a.Type == "" {
+		return TypeString
+	}
+	return a.Type
+}
+
+// Check returns an error when value does not match the type or enum of the arg
+func (a Arg) Check(value string) error {
+	if err := check(a.ValueType(), a.Enum, value); err != nil {
+		return fmt.Errorf("invalid value %q for <%s>: %v", value, a.Name, err)
+	}
+	return nil
+}
+
+// ValueType returns the type of the flag value
+func (f Flag) ValueType() string {
+	switch {
+	case f.Type != "":
+		return f.Type
+	case f.Value == "":
+		return TypeBoolean
+	}
+	return TypeString
+}
+
+// Check returns an error when value, or any element of the value of a List flag, does not match the type
+// or enum of the flag
+func (f Flag) Check(value string) error {
+	values := []string{value}
+	if f.List {
+		values = strings.Split(value, ",")
+	}
+	for _, v := range values {
+		if f.List {
+			v = strings.TrimSpace(v)
+			if v == "" {
+				continue
+			}
+		}
+		if err := check(f.ValueType(), f.Enum, v); err != nil {
+			return fmt.Errorf("invalid value %q for --%s: %v", value, f.Name, err)
+		}
+	}
+	return nil
+}
+
+// check returns an error when value does not match typ or enum, integers may be written in any base
+// strconv accepts with a prefix, e.g. 0x10
+func check(typ string, enum []string, value string) error {
+	var err error
+	switch typ {
+	case TypeInteger:
+		_, err = strconv.ParseInt(value, 0, 64)
+	case TypeNumber:
+		_, err = strconv.ParseFloat(value, 64)
+	case TypeBoolean:
+		_, err = strconv.ParseBool(value)
+	}
+	if err != nil {
+		article := "a"
+		if strings.IndexByte("aeiou", typ[0]) >= 0 {
+			article = "an"
+		}
+		return fmt.Errorf("not %s %s", article, typ)
+	}
+	if len(enum) == 0 {
+		return nil
+	}
+	for _, e := range enum {
+		if e == value {
+			return nil
+		}
+	}
+	return fmt.Errorf("must be one of %s", strings.Join(enum, ", "))
+}
+
+// Example is a sample invocation of a command with an optional explanation
+type Example struct {
+	Command string
+	Help    string
+}
+
+// Parse splits args into positional args and the values of flags
+// --name value, --name=value, -s value and -s=value are accepted, flags without a Value
+// placeholder are booleans set to "true" unless given an explicit =value
+// Repeated flags accumulate their values and -- ends flag parsing
+// Values not matching the Type or Enum of their flag are rejected
+func Parse(flags []Flag, args []string) ([]string, map[string][]string, error) {
+	var positional []string
+	values := map[string][]string{}
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" {
+			positional = append(positional, args[i+1:]...)
+			break
+		}
+		if len(a) < 2 || a[0] != '-' || isNumber(a) {
+			positional = append(positional, a)
+			continue
+		}
+		name, value := strings.TrimLeft(a, "-"), ""
+		hasValue := false
+		if j := strings.Index(name, "="); j >= 0 {
+			name, value, hasValue = name[:j], name[j+1:], true
+		}
+		f, ok := lookupFlag(flags, name, strings.HasPrefix(a, "--"))
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown flag %s", a)
+		}
+		if !hasValue {
+			if f.Value == "" {
+				value = "true"
+			} else {
+				if i+1 >= len(args) {
+					return nil, nil, fmt.Errorf("flag --%s needs a value", f.Name)
+				}
+				i++
+				value = args[i]
+			}
+		}
+		if err := f.Check(value); err != nil {
+			return nil, nil, err
+		}
+		values[f.Name] = append(values[f.Name], value)
+	}
+	return positional, values, nil
+}
+
+func lookupFlag(flags []Flag, name string, long bool) (Flag, bool) {
+	for _, f := range flags {
+		if (long && f.Name == name) || (!long && (f.Short == name || (f.Short == "" && f.Name == name))) {
+			return f, true
+		}
+	}
+	return Flag{}, false
+}
+
+func isNumber(s string) bool {
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
@@ -1,11 +1,100 @@
 package command
 
-//ICommand interface
+import (
+	"context"
+	"reflect"
+)
+
+// ICommand interface
+// It is implemented by Command and by any type that wants to be registered as a command,
+// e.g. a struct carrying its own dependencies or a mock in tests
 type ICommand interface {
+	// Count the number of subcommands
 	Count() int
+	// Info returns the name and documentation of the command
+	Info() Info
+	// Children returns the subcommands
+	Children() []ICommand
+	// Run executes the command with the args following its name
+	Run(ctx context.Context, args []string) error
+}
+
+// Completer can be implemented by an ICommand to complete its positional args
+// It has the semantics of Command.Complete
+type Completer interface {
+	Complete(args []string) []string
 }
 
-//Count the number of subcommands
+// Runnable can be implemented by an ICommand to report whether it has something to run, like
+// Command.Runnable. A group of subcommands returns false so typing its name shows its help,
+// an ICommand not implementing it is runnable
+type Runnable interface {
+	Runnable() bool
+}
+
+// Info is the name and documentation of a command, see Command for the meaning of each field
+type Info struct {
+	Name      string
+	Aliases   []string
+	Category  string
+	Usage     string
+	Help      string
+	ManPage   string
+	Args      []Arg
+	Flags     []Flag
+	Examples  []Example
+	Dangerous bool
+}
+
+// Count the number of subcommands
 func Count(i ICommand) int {
 	return i.Count()
 }
+
+// From converts any ICommand and its children to a Command
+// Commands are returned as is, other implementations are wrapped so running the
+// returned Command calls their Run method, unless they implement Runnable and report false
+// A nil ICommand, or a nil pointer, converts to the zero Command, whose empty name fails validation
+func From(i ICommand) Command {
+	if isNil(i) {
+		return Command{}
+	}
+	switch c := i.(type) {
+	case Command:
+		return c
+	case *Command:
+		return *c
+	}
+	info := i.Info()
+	c := Command{
+		Name:      info.Name,
+		Aliases:   info.Aliases,
+		Category:  info.Category,
+		Usage:     info.Usage,
+		Help:      info.Help,
+		ManPage:   info.ManPage,
+		Args:      info.Args,
+		Flags:     info.Flags,
+		Examples:  info.Examples,
+		Dangerous: info.Dangerous,
+	}
+	if r, ok := i.(Runnable); !ok || r.Runnable() {
+		c.Handler = i.Run
+	}
+	if completer, ok := i.(Completer); ok {
+		c.Complete = completer.Complete
+	}
+	for _, child := range i.Children() {
+		c.SubCommands = append(c.SubCommands, From(child))
+	}
+	return c
+}
+
+// isNil reports whether i is nil or holds a nil pointer
+func isNil(i ICommand) bool {
+	if i == nil {
+		return true
+	}
+	v := reflect.ValueOf(i)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
@@ -0,0 +1,22 @@
+package command
+
+import (
+	"context"
+	"io"
+	"os"
+)
+
+type outputKey struct{}
+
+// WithOutput returns a copy of ctx in which commands write to w, e.g. the connection of a remote session
+func WithOutput(ctx context.Context, w io.Writer) context.Context {
+	return context.WithValue(ctx, outputKey{}, w)
+}
+
+// Output returns the writer a command running with ctx writes to, os.Stdout unless set with WithOutput
+func Output(ctx context.Context) io.Writer {
+	if w, ok := ctx.Value(outputKey{}).(io.Writer); ok {
+		return w
+	}
+	return os.Stdout
+}
@@ -1,71 +1,64 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"os"
 
-	"github.com/AlexsJones/cli/cli"
-	"github.com/AlexsJones/cli/command"
+	"github.com/loicalleyne/cli/cli"
+	"github.com/loicalleyne/cli/command"
 )
 
-func AddCommands(c *cli.Cli) {
-	c.AddCommand(command.Command{
-		Name: "github",
-		Help: "github primary command interface",
-		Func: func(args []string) {
-			fmt.Println("I do nothing...")
-		},
-		SubCommands: []command.Command{
-			command.Command{
-				Name: "login",
-				Help: "access token to github",
-				Func: func(args []string) {
-					if len(args) == 0 {
-						fmt.Println("Failed login")
-						return
-					}
-					fmt.Printf("Logged in %s", args[0])
-				},
-			},
-			command.Command{
-				Name: "logout",
-				Help: "allows you to logout from github",
-				Func: func(args []string) {
-					if len(args) == 0 {
-						fmt.Println("Failed logout")
-						return
-					}
-					fmt.Printf("Logged out with username %s\n", args[0])
-				},
-			},
-		},
-	})
-	c.AddCommand(command.Command{
+// GitHub is registered with Cli.Register, its exported methods become subcommands
+type GitHub struct {
+	_ struct{} `name:"github" help:"github primary command interface"`
+	_ struct{} `cli:"login <token> --scope" help:"access token to github"`
+	_ struct{} `cli:"logout <username>" help:"allows you to logout from github"`
+}
+
+// Login logs in with an access token
+func (g *GitHub) Login(ctx context.Context, token string, scope []string) error {
+	fmt.Fprintf(cli.Output(ctx), "Logged in %s with scopes %v\n", token, scope)
+	return nil
+}
+
+// Logout logs the user out
+func (g *GitHub) Logout(ctx context.Context, username string) {
+	fmt.Fprintf(cli.Output(ctx), "Logged out with username %s\n", username)
+}
+
+func AddCommands(c *cli.Cli) error {
+	if err := c.Register(&GitHub{}); err != nil {
+		return err
+	}
+	return c.AddCommand(command.Command{
 		Name: "sql",
 		Help: "sql primary command interface",
-		Func: func(args []string) {
-			fmt.Println("I do nothing...")
+		Handler: func(ctx context.Context, args []string) error {
+			fmt.Fprintln(cli.Output(ctx), "I do nothing...")
+			return nil
 		},
 		SubCommands: []command.Command{
 			command.Command{
 				Name: "login",
 				Help: "access token to github",
-				Func: func(args []string) {
+				Handler: func(ctx context.Context, args []string) error {
 					if len(args) == 0 {
-						fmt.Println("Failed login")
-						return
+						return fmt.Errorf("failed login")
 					}
-					fmt.Printf("Logged in %s", args[0])
+					fmt.Fprintf(cli.Output(ctx), "Logged in %s\n", args[0])
+					return nil
 				},
 			},
 			command.Command{
 				Name: "logout",
 				Help: "allows you to logout from github",
-				Func: func(args []string) {
+				Handler: func(ctx context.Context, args []string) error {
 					if len(args) == 0 {
-						fmt.Println("Failed logout")
-						return
+						return fmt.Errorf("failed logout")
 					}
-					fmt.Printf("Logged out with username %s\n", args[0])
+					fmt.Fprintf(cli.Output(ctx), "Logged out with username %s\n", args[0])
+					return nil
 				},
 				SubCommands: []command.Command{
 					command.Command{
@@ -80,6 +73,12 @@ func AddCommands(c *cli.Cli) {
 func main() {
 
 	c := cli.NewCli()
-	AddCommands(c)
-	c.Run()
+	if err := AddCommands(c); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if err := c.Run(context.Background()); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 }
@@ -1,9 +1,12 @@
 module github.com/loicalleyne/cli
 
-go 1.14
+go 1.18
 
 require (
 	github.com/chzyer/readline v0.0.0-20180603132655-2972be24d48e
 	github.com/chzyer/test v1.0.0 // indirect
 	github.com/fatih/color v1.9.0
+	github.com/pelletier/go-toml/v2 v2.0.9
+	golang.org/x/crypto v0.17.0
+	gopkg.in/yaml.v3 v3.0.1
 )
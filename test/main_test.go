@@ -1,10 +1,29 @@
 package main
 
 import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/fatih/color"
 	"github.com/loicalleyne/cli/cli"
+	"github.com/loicalleyne/cli/cli/doc"
 	"github.com/loicalleyne/cli/command"
+	"github.com/loicalleyne/cli/vault"
+	"golang.org/x/crypto/ssh"
 )
 
 /*********************************************************************************
@@ -17,9 +36,2180 @@ import (
 func TestAddCommand(t *testing.T) {
 	cli := cli.NewCli()
 
-	cli.AddCommand(command.Command{})
+	cli.AddCommand(command.Command{Name: "github"})
 
 	if len(cli.Commands) != 1 {
 		t.Error("Incorrect arg count")
 	}
 }
+
+func TestAddCommandValidation(t *testing.T) {
+	c := cli.NewCli()
+
+	invalid := []command.Command{
+		{},
+		{Name: "git hub"},
+		{Name: "help"},
+		{Name: "github", SubCommands: []command.Command{{Name: "login"}, {Name: "login"}}},
+		{Name: "github", SubCommands: []command.Command{{Name: "login", SubCommands: []command.Command{{}}}}},
+	}
+	for _, cmd := range invalid {
+		if err := c.AddCommand(cmd); err == nil {
+			t.Errorf("expected an error registering %+v", cmd)
+		}
+	}
+	if len(c.Commands) != 0 {
+		t.Errorf("invalid commands were registered: %d", len(c.Commands))
+	}
+
+	if err := c.AddCommand(command.Command{Name: "github"}); err != nil {
+		t.Error(err)
+	}
+	if err := c.AddCommand(command.Command{Name: "github"}); err == nil {
+		t.Error("expected duplicate root command to be rejected")
+	}
+}
+
+func TestLint(t *testing.T) {
+	c := cli.NewCli()
+	c.AddCommand(command.Command{
+		Name:    "github",
+		Help:    "github primary command interface",
+		ManPage: "github",
+		SubCommands: []command.Command{
+			{Name: "login"},
+		},
+	})
+
+	if errs := cli.Lint(c); len(errs) != 2 {
+		t.Errorf("expected 2 lint errors, got %v", errs)
+	}
+}
+
+func TestHelp(t *testing.T) {
+	c := cli.NewCli()
+	c.AddCommand(command.Command{
+		Name: "github",
+		Help: "github primary command interface",
+		SubCommands: []command.Command{
+			{
+				Name:     "login",
+				Aliases:  []string{"signin"},
+				Help:     "access token to github",
+				Args:     []command.Arg{{Name: "token", Required: true}},
+				Flags:    []command.Flag{{Name: "scope", Short: "s", Value: "scope"}},
+				Examples: []command.Example{{Command: "github login abc123"}},
+			},
+		},
+	})
+
+	var b strings.Builder
+	if err := c.Help(&b, "github", "signin"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"github login [flags] <token>", "-s, --scope scope", "github login abc123", "login, signin"} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("help output missing %q:\n%s", want, b.String())
+		}
+	}
+	if err := c.Help(&b, "github", "logout"); err == nil {
+		t.Error("expected an error for an unknown command path")
+	}
+
+	// system commands and their subcommands, with help or --help
+	s, err := c.NewSession(ioutil.NopCloser(strings.NewReader("")), ioutil.Discard, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for line, want := range map[string]string{
+		"help schedule add":   "schedule add <cron expression> <command...>",
+		"schedule add --help": "schedule add <cron expression> <command...>",
+		"schedule -h":         "Subcommands:",
+		"watch --help":        "watch [-n interval] <command...>",
+	} {
+		var out strings.Builder
+		s, err := c.NewSession(ioutil.NopCloser(strings.NewReader("")), &out, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Exec(context.Background(), line); err != nil || !strings.Contains(out.String(), want) {
+			t.Errorf("%s: expected %q, got %v:\n%s", line, want, err, out.String())
+		}
+	}
+	if err := s.Exec(context.Background(), "help schedule nope"); err == nil {
+		t.Error("expected an error for an unknown system subcommand")
+	}
+}
+
+func TestMan(t *testing.T) {
+	c := cli.NewCli()
+	c.AddCommand(command.Command{
+		Name: "github",
+		SubCommands: []command.Command{
+			{
+				Name: "login",
+				Help: "access token to github",
+				ManPage: "# Description\n\nLogs in with a **personal** access token, see " +
+					"[tokens](https://github.com/settings/tokens). " + strings.Repeat("word ", 40) +
+					"\n\n- first item\n- second item\n\n```\ngithub login abc123\n```\n",
+			},
+		},
+	})
+
+	var b strings.Builder
+	if err := c.Man(&b, "github", "login"); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, want := range []string{"GITHUB LOGIN", "DESCRIPTION", "Logs in with a personal access token", "• first item", "        github login abc123"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("manpage missing %q:\n%s", want, out)
+		}
+	}
+	for _, l := range strings.Split(out, "\n") {
+		if len(l) > 80 {
+			t.Errorf("line not wrapped to 80 columns: %q", l)
+		}
+	}
+	if err := c.Man(&b, "github"); err == nil {
+		t.Error("expected an error for a command without manpage")
+	}
+}
+
+func TestDoc(t *testing.T) {
+	c := cli.NewCli()
+	c.AddCommand(command.Command{
+		Name: "github",
+		Help: "github primary command interface",
+		SubCommands: []command.Command{
+			{
+				Name:    "login",
+				Help:    "access token to github",
+				ManPage: "# Description\n\nLogs in with a `token`.",
+				Flags:   []command.Flag{{Name: "scope", Value: "scope", Help: "token scope"}},
+			},
+		},
+	})
+
+	dir, err := ioutil.TempDir("", "doc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := doc.GenMarkdownTree(c, dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.GenManTree(c, nil, dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.GenHTMLTree(c, "github", dir); err != nil {
+		t.Fatal(err)
+	}
+	for file, want := range map[string]string{
+		"github.md":       "* [github login](github_login.md)",
+		"github_login.md": "### Description",
+		"github-login.1":  ".SH OPTIONS",
+		"index.html":      `<section id="github-login">`,
+	} {
+		b, err := ioutil.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(b), want) {
+			t.Errorf("%s missing %q:\n%s", file, want, b)
+		}
+	}
+}
+
+func TestComplete(t *testing.T) {
+	c := cli.NewCli()
+	c.AddCommand(command.Command{
+		Name:    "github",
+		Aliases: []string{"gh"},
+		SubCommands: []command.Command{
+			{
+				Name:     "login",
+				Flags:    []command.Flag{{Name: "scope", Short: "s"}},
+				Complete: func(args []string) []string { return []string{"alice", "bob"} },
+			},
+			{Name: "logout"},
+		},
+	})
+
+	for _, tc := range []struct {
+		words []string
+		want  string
+	}{
+		{[]string{"g"}, "gh github"},
+		{[]string{"gh", "lo"}, "login logout"},
+		{[]string{"github", "login", ""}, "alice bob"},
+		{[]string{"github", "login", "-"}, "--help --scope -s"},
+		{[]string{"help", "github", "logi"}, "login"},
+	} {
+		if got := strings.Join(c.Complete(tc.words), " "); got != tc.want {
+			t.Errorf("Complete(%q) = %q, want %q", tc.words, got, tc.want)
+		}
+	}
+
+	var b strings.Builder
+	if err := c.GenBashCompletion(&b, "myapp"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "complete -F _myapp myapp") || !strings.Contains(b.String(), "'github|login'") {
+		t.Errorf("unexpected bash completion script:\n%s", b.String())
+	}
+}
+
+func TestApropos(t *testing.T) {
+	c := cli.NewCli()
+	c.AddCommand(command.Command{
+		Name: "sql",
+		Help: "sql primary command interface",
+		SubCommands: []command.Command{
+			{
+				Name: "logout",
+				Help: "allows you to logout from the database",
+				SubCommands: []command.Command{
+					{Name: "defer", Help: "Defer a logout"},
+				},
+			},
+		},
+	})
+	c.AddCommand(command.Command{Name: "github", Help: "github primary command interface"})
+
+	var b strings.Builder
+	if err := c.Apropos(&b, "defer"); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(b.String()), "\n"); len(lines) != 1 || !strings.HasPrefix(lines[0], "sql logout defer") {
+		t.Errorf("unexpected apropos output:\n%s", b.String())
+	}
+
+	b.Reset()
+	c.Apropos(&b, "logout")
+	if !strings.HasPrefix(b.String(), "sql logout ") {
+		t.Errorf("expected the name match first:\n%s", b.String())
+	}
+	if err := c.Apropos(&b, "nothing"); err == nil {
+		t.Error("expected an error when nothing matches")
+	}
+}
+
+// loginCommand is an ICommand implemented as a struct, recording its invocations
+type loginCommand struct {
+	calls [][]string
+}
+
+func (l *loginCommand) Count() int { return 0 }
+
+func (l *loginCommand) Info() command.Info {
+	return command.Info{Name: "login", Help: "access token to github"}
+}
+
+func (l *loginCommand) Children() []command.ICommand { return nil }
+
+func (l *loginCommand) Run(ctx context.Context, args []string) error {
+	l.calls = append(l.calls, args)
+	if len(args) == 0 {
+		return errors.New("token required")
+	}
+	return nil
+}
+
+// githubGroup is an ICommand grouping subcommands, with nothing to run of its own
+type githubGroup struct {
+	login *loginCommand
+}
+
+func (g *githubGroup) Count() int { return 1 }
+
+func (g *githubGroup) Info() command.Info {
+	return command.Info{Name: "gh", Help: "github commands"}
+}
+
+func (g *githubGroup) Children() []command.ICommand { return []command.ICommand{g.login} }
+
+func (g *githubGroup) Run(ctx context.Context, args []string) error {
+	return errors.New("a group does not run")
+}
+
+func (g *githubGroup) Runnable() bool { return false }
+
+func TestICommand(t *testing.T) {
+	login := &loginCommand{}
+	c := cli.NewCli()
+	if err := cli.AddCommand(c, command.Command{
+		Name:        "github",
+		SubCommands: []command.Command{command.From(login)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	sub := c.Commands[0].SubCommands[0]
+	if sub.Name != "login" || sub.Help != "access token to github" {
+		t.Errorf("metadata not converted: %+v", sub)
+	}
+	if err := sub.Run(context.Background(), []string{"abc123"}); err != nil {
+		t.Error(err)
+	}
+	if err := sub.Run(context.Background(), nil); err == nil {
+		t.Error("expected the error of the implementation")
+	}
+	if len(login.calls) != 2 || login.calls[0][0] != "abc123" {
+		t.Errorf("unexpected calls: %v", login.calls)
+	}
+
+	// nil commands are refused, not dereferenced
+	for _, i := range []command.ICommand{nil, (*command.Command)(nil), (*loginCommand)(nil), &githubGroup{}} {
+		if err := c.AddCommand(i); err == nil {
+			t.Errorf("expected an error adding %#v", i)
+		}
+	}
+
+	// a group shows its help when typed alone and dispatches to its children
+	if err := c.AddCommand(&githubGroup{login: login}); err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	s, err := c.NewSession(ioutil.NopCloser(strings.NewReader("")), &out, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Exec(context.Background(), "gh"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "access token to github") {
+		t.Errorf("expected the help of the group, got %q", out.String())
+	}
+	if err := s.Exec(context.Background(), "gh login xyz"); err != nil || len(login.calls) != 3 {
+		t.Errorf("subcommand of the group not run: %v %v", err, login.calls)
+	}
+}
+
+type gitHub struct {
+	token  string
+	scopes []string
+	repos  int
+	ids    []int
+
+	_ struct{} `name:"github" help:"github primary command interface"`
+	_ struct{} `cli:"login <token> --scope" help:"log in with a token" aliases:"signin"`
+}
+
+func (g *gitHub) Login(ctx context.Context, token string, scope []string) error {
+	g.token, g.scopes = token, scope
+	return nil
+}
+
+func (g *gitHub) ListRepos(opts struct {
+	Owner string `arg:"owner"`
+	Limit int    `flag:"limit" short:"l" default:"30"`
+}) error {
+	if opts.Owner == "" {
+		return errors.New("no owner")
+	}
+	g.repos = opts.Limit
+	return nil
+}
+
+func (g *gitHub) Close(opts struct {
+	IDs []int `flag:"ids"`
+}) error {
+	g.ids = opts.IDs
+	return nil
+}
+
+// GitHub is registered without tags
+type GitHub struct{}
+
+func (g GitHub) Login(ctx context.Context, token string, scope []string) error {
+	fmt.Fprintln(cli.Output(ctx), token, scope)
+	return nil
+}
+
+func (g GitHub) Star(repos ...string) error {
+	return nil
+}
+
+func TestReflectUntagged(t *testing.T) {
+	c, err := cli.Reflect(GitHub{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "github" {
+		t.Errorf("expected the type name in lower case, got %q", c.Name)
+	}
+	login := c.SubCommands[0]
+	if len(login.Args) != 1 || !login.Args[0].Required || len(login.Flags) != 1 || !login.Flags[0].List {
+		t.Fatalf("expected github login <arg1> --arg2, got %+v %+v", login.Args, login.Flags)
+	}
+	var out strings.Builder
+	if err := login.Run(command.WithOutput(context.Background(), &out), []string{"abc", "--arg2", "repo,gist"}); err != nil || out.String() != "abc [repo gist]\n" {
+		t.Errorf("unexpected binding %v %q", err, out.String())
+	}
+	if star := c.SubCommands[1]; len(star.Args) != 1 || !star.Args[0].Variadic {
+		t.Errorf("expected a variadic arg for a variadic method, got %+v", star.Args)
+	}
+
+	for _, obj := range []interface{}{nil, (*GitHub)(nil), "github"} {
+		if _, err := cli.Reflect(obj); err == nil {
+			t.Errorf("expected an error reflecting %#v", obj)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	g := &gitHub{}
+	c := cli.NewCli()
+	if err := c.Register(g); err != nil {
+		t.Fatal(err)
+	}
+
+	var b strings.Builder
+	if err := c.Help(&b, "github", "signin"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "github login [flags] <token>") {
+		t.Errorf("unexpected help:\n%s", b.String())
+	}
+
+	login, _ := c.Lookup("github.login")
+	if err := login.Run(context.Background(), []string{"abc123", "--scope", "repo,gist", "--scope=user"}); err != nil {
+		t.Fatal(err)
+	}
+	if g.token != "abc123" || strings.Join(g.scopes, " ") != "repo gist user" {
+		t.Errorf("unexpected binding: %q %q", g.token, g.scopes)
+	}
+	if err := login.Run(context.Background(), nil); err == nil {
+		t.Error("expected an error for a missing argument")
+	}
+
+	list, _ := c.Lookup("github.list-repos")
+	if list.Name != "list-repos" {
+		t.Fatalf("unexpected command %q", list.Name)
+	}
+	if err := list.Run(context.Background(), []string{"alex"}); err != nil || g.repos != 30 {
+		t.Errorf("default not applied: %v %d", err, g.repos)
+	}
+	if err := list.Run(context.Background(), []string{"-l", "5", "alex"}); err != nil || g.repos != 5 {
+		t.Errorf("flag not applied: %v %d", err, g.repos)
+	}
+
+	// list flags check every element, integers in any base setValue accepts
+	s, err := c.NewSession(ioutil.NopCloser(strings.NewReader("")), ioutil.Discard, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Exec(context.Background(), "github close --ids 1,0x10 --ids=3"); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(g.ids) != "[1 16 3]" {
+		t.Errorf("unexpected list binding %v", g.ids)
+	}
+	err = s.Exec(context.Background(), "github close --ids 1,two")
+	if err == nil || !strings.Contains(err.Error(), "not an integer") {
+		t.Errorf("expected an invalid element to be rejected, got %v", err)
+	}
+}
+
+func TestLoadCommands(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli-load")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+
+	files := map[string]string{
+		"cmds.yaml": `
+commands:
+  - name: deploy
+    help: deploy a service
+    args:
+      - name: service
+        required: true
+    flags:
+      - name: env
+        value: env
+        default: staging
+    shell: echo {{.Flag.env}} {{.Arg.service}} > ` + out + `
+`,
+		"cmds.json": `{"commands": [{"name": "status", "help": "show status", "handler": "status"}]}`,
+		"cmds.toml": `
+[[commands]]
+name = "db"
+help = "database commands"
+
+[[commands.subcommands]]
+name = "ping"
+handler = "status"
+`,
+	}
+	c := cli.NewCli()
+	var called int
+	c.RegisterHandler("status", func(ctx context.Context, args []string) error {
+		called++
+		return nil
+	})
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.LoadCommands(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(c.Commands) != 3 {
+		t.Fatalf("expected 3 commands, got %d", len(c.Commands))
+	}
+
+	for _, cmd := range c.Commands {
+		switch cmd.Name {
+		case "deploy":
+			if err := cmd.Run(context.Background(), []string{"it's"}); err != nil {
+				t.Fatal(err)
+			}
+			b, err := ioutil.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.TrimSpace(string(b)) != "staging it's" {
+				t.Errorf("unexpected shell output %q", b)
+			}
+			if err := cmd.Run(context.Background(), nil); err == nil {
+				t.Error("expected an error for a missing argument")
+			}
+		case "status":
+			cmd.Run(context.Background(), nil)
+		case "db":
+			cmd.SubCommands[0].Run(context.Background(), nil)
+		}
+	}
+	if called != 2 {
+		t.Errorf("expected 2 handler calls, got %d", called)
+	}
+
+	bad := filepath.Join(dir, "bad.json")
+	ioutil.WriteFile(bad, []byte(`{"commands": [{"name": "x", "handler": "missing"}]}`), 0644)
+	if err := c.LoadCommands(bad); err == nil {
+		t.Error("expected an error for an unregistered handler")
+	}
+	for _, content := range []string{
+		`{"commands": [{"name": "ok", "handler": "status"}, {"name": "bad name", "handler": "status"}]}`,
+		`{"commands": [{"name": "ok", "handler": "status"}, {"name": "ok", "handler": "status"}]}`,
+		`{"commands": [{"name": "ok", "handler": "status"}, {"name": "deploy", "handler": "status"}]}`,
+	} {
+		ioutil.WriteFile(bad, []byte(content), 0644)
+		if err := c.LoadCommands(bad); err == nil {
+			t.Errorf("expected an error loading %s", content)
+		}
+		if _, ok := c.Lookup("ok"); ok || len(c.Commands) != 3 {
+			t.Errorf("a failed load of %s left %d commands", content, len(c.Commands))
+		}
+	}
+}
+
+func TestDiscoverPlugins(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli-plugins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+
+	script := `#!/bin/sh
+if [ "$1" = --cli-describe ]; then
+	echo '{"help": "say hello", "subcommands": [{"name": "world", "help": "greet the world"}]}'
+	exit 0
+fi
+echo "$@" > ` + out + `
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, "app-hello"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "app-bare"), []byte("#!/bin/sh\nexit 1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "app-data"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// invalid plugins are skipped without stopping the discovery, system command names are taken
+	dup := "#!/bin/sh\necho '{\"subcommands\": [{\"name\": \"a\"}, {\"name\": \"a\"}]}'\n"
+	for name, content := range map[string]string{"app-a-dup": dup, "app-v1.2": "#!/bin/sh\n", "app-help": "#!/bin/sh\n"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := cli.NewCli()
+	err = c.DiscoverPlugins("app", dir)
+	if err == nil || !strings.Contains(err.Error(), "app-a-dup") || !strings.Contains(err.Error(), "app-v1.2") {
+		t.Errorf("expected the invalid plugins to be reported, got %v", err)
+	}
+	if len(c.Commands) != 2 {
+		t.Fatalf("expected 2 plugins, got %d", len(c.Commands))
+	}
+	for _, cmd := range c.Commands {
+		switch cmd.Name {
+		case "bare":
+			if !strings.HasPrefix(cmd.Help, "plugin ") {
+				t.Errorf("unexpected help %q", cmd.Help)
+			}
+		case "hello":
+			if cmd.Help != "say hello" || len(cmd.SubCommands) != 1 {
+				t.Fatalf("plugin not described: %+v", cmd)
+			}
+			if err := cmd.SubCommands[0].Run(context.Background(), []string{"-v", "x"}); err != nil {
+				t.Fatal(err)
+			}
+			b, _ := ioutil.ReadFile(out)
+			if strings.TrimSpace(string(b)) != "world -v x" {
+				t.Errorf("unexpected plugin args %q", b)
+			}
+		default:
+			t.Errorf("unexpected plugin %q", cmd.Name)
+		}
+	}
+	if got := c.Complete([]string{"hello", ""}); len(got) != 1 || got[0] != "world" {
+		t.Errorf("unexpected completion %q", got)
+	}
+}
+
+func TestDynamicSubCommands(t *testing.T) {
+	servers := []string{"alpha"}
+	var calls int
+	var ran string
+	c := cli.NewCli()
+	err := c.AddCommand(command.Command{
+		Name: "server",
+		Help: "manage servers",
+		Dynamic: func() []command.Command {
+			calls++
+			var subs []command.Command
+			for _, s := range servers {
+				name := s
+				subs = append(subs, command.Command{Name: name, Help: "connect to " + name, Out: func(w io.Writer, args []string) {
+					ran = name
+				}})
+			}
+			return subs
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	servers = append(servers, "beta")
+	if got := c.Complete([]string{"server", ""}); strings.Join(got, " ") != "alpha beta" {
+		t.Errorf("unexpected completion %q", got)
+	}
+	var b strings.Builder
+	if err := c.Help(&b, "server", "beta"); err != nil || !strings.Contains(b.String(), "connect to beta") {
+		t.Errorf("unexpected help %v:\n%s", err, b.String())
+	}
+	if err := c.Commands[0].AllSubCommands()[1].Run(context.Background(), nil); err != nil || ran != "beta" {
+		t.Errorf("dynamic subcommand not dispatched: %v %q", err, ran)
+	}
+
+	calls = 0
+	cached := command.Command{Name: "server", Dynamic: command.Cached(0, c.Commands[0].Dynamic)}
+	cached.AllSubCommands()
+	servers = append(servers, "gamma")
+	if n := len(cached.AllSubCommands()); n != 2 || calls != 1 {
+		t.Errorf("expected a cached result, got %d subcommands after %d calls", n, calls)
+	}
+
+	s, err := c.NewSession(ioutil.NopCloser(strings.NewReader("")), ioutil.Discard, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ran = ""
+	if err := s.Exec(context.Background(), "server alpha"); err != nil || ran != "alpha" {
+		t.Errorf("dynamic subcommand not run through Exec: %v %q", err, ran)
+	}
+	for _, bad := range [][]string{{"alpha", "alpha"}, {"bad name"}, {"a.b"}} {
+		servers = bad
+		ran = ""
+		err := s.Exec(context.Background(), "server alpha")
+		if err == nil || ran != "" {
+			t.Errorf("expected invalid dynamic subcommands %q to be refused, got %v and ran %q", bad, err, ran)
+		}
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	c := cli.NewCli()
+	for _, name := range []string{"github", "vault"} {
+		err := c.AddCommand(command.Command{Name: name, Help: name, SubCommands: []command.Command{
+			{Name: "login", Help: "login"},
+			{Name: "logout", Help: "logout"},
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := c.RemoveCommand("github", "logout"); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Complete([]string{"github", "lo"}); strings.Join(got, " ") != "login" {
+		t.Errorf("unexpected completion after remove %q", got)
+	}
+	if err := c.RemoveCommand("github", "logout"); err == nil {
+		t.Error("expected an error removing a missing command")
+	}
+
+	if err := c.ReplaceCommand(command.Command{Name: "login", Help: "new login"}, "vault", "login"); err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	if err := c.Help(&b, "vault"); err != nil || !strings.Contains(b.String(), "new login") {
+		t.Errorf("unexpected help after replace %v:\n%s", err, b.String())
+	}
+	if err := c.ReplaceCommand(command.Command{Name: "logout"}, "vault", "login"); err == nil {
+		t.Error("expected an error replacing with a duplicate name")
+	}
+
+	if err := c.RemoveCommand("vault"); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Complete([]string{"vau"}); len(got) != 0 {
+		t.Errorf("removed command still completed %q", got)
+	}
+
+	other := cli.NewCli()
+	if err := c.Mount("ops", other); err != nil {
+		t.Fatal(err)
+	}
+	other.AddCommand(command.Command{Name: "deploy", Help: "deploy"})
+	if got := c.Complete([]string{"ops", ""}); strings.Join(got, " ") != "deploy" {
+		t.Errorf("unexpected completion of the mount %q", got)
+	}
+
+	// cycles are refused along the whole mount chain
+	third := cli.NewCli()
+	if err := other.Mount("deep", third); err != nil {
+		t.Fatal(err)
+	}
+	if err := third.Mount("back", c); err == nil {
+		t.Error("expected a mount cycle to be refused")
+	}
+	if err := third.Mount("up", other); err == nil {
+		t.Error("expected a mount cycle to be refused")
+	}
+	// once unmounted the Clis can be mounted the other way
+	if err := other.RemoveCommand("deep"); err != nil {
+		t.Fatal(err)
+	}
+	if err := third.Mount("up", other); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCommandIndex(t *testing.T) {
+	var got []string
+	c := cli.NewCli()
+	err := c.AddCommand(command.Command{Name: "github", Aliases: []string{"gh"}, Help: "github", SubCommands: []command.Command{
+		{Name: "login", Help: "login", Func: func(args []string) { got = args }},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	index := cli.CreateCommandIndex(c)
+	for _, path := range []string{"gh.login", "github.login"} {
+		if l, ok := index.Get(path); !ok || l.Help != "login" {
+			t.Errorf("%s not found in the index", path)
+		}
+	}
+	if err := c.AddCommand(command.Command{Name: "v1.2", Help: "dotted"}); err == nil {
+		t.Error("expected a dotted name to be refused")
+	}
+	if _, ok := c.Lookup("github.logout"); ok {
+		t.Error("found a missing command")
+	}
+	if err := c.Invoke(context.Background(), "gh.login", []string{"abc"}); err != nil || strings.Join(got, " ") != "abc" {
+		t.Errorf("unexpected invoke %v %q", err, got)
+	}
+	if err := c.Invoke(context.Background(), "github.logout", nil); err == nil {
+		t.Error("expected an error invoking a missing command")
+	}
+
+	// the index follows the tree as it changes
+	if err := c.RemoveCommand("github", "login"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Lookup("github.login"); ok {
+		t.Error("removed command still indexed")
+	}
+}
+
+func TestSchema(t *testing.T) {
+	c := cli.NewCli()
+	err := c.AddCommand(command.Command{Name: "github", Help: "github", SubCommands: []command.Command{{
+		Name: "list-repos",
+		Help: "list repositories",
+		Args: []command.Arg{{Name: "owner", Required: true}, {Name: "topics", Variadic: true}},
+		Flags: []command.Flag{
+			{Name: "limit", Value: "n", Type: command.TypeInteger, Default: "30"},
+			{Name: "sort", Value: "field", Enum: []string{"name", "stars"}},
+			{Name: "archived"},
+		},
+		Func: func(args []string) {},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schemas := c.Schemas()
+	if len(schemas) != 2 || schemas[1].Path != "github.list-repos" || schemas[0].Runnable || !schemas[1].Runnable {
+		t.Fatalf("unexpected schemas %+v", schemas)
+	}
+	p := schemas[1].Params
+	if strings.Join(p.Required, " ") != "owner" || p.Properties["topics"].Type != "array" ||
+		p.Properties["limit"].Default != int64(30) || p.Properties["archived"].Type != command.TypeBoolean ||
+		len(p.Properties["sort"].Enum) != 2 {
+		t.Errorf("unexpected params %+v", p)
+	}
+
+	var b strings.Builder
+	if err := c.WriteSchema(&b); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), `"path": "github.list-repos"`) {
+		t.Errorf("unexpected schema:\n%s", b.String())
+	}
+
+	flags := c.Commands[0].SubCommands[0].Flags
+	for _, args := range [][]string{{"--sort", "size"}, {"--limit=many"}} {
+		if _, _, err := command.Parse(flags, args); err == nil {
+			t.Errorf("expected %q to be rejected", args)
+		}
+	}
+	if _, _, err := command.Parse(flags, []string{"--sort", "stars", "--limit", "5"}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestServe(t *testing.T) {
+	c := cli.NewCli()
+	err := c.AddCommand(command.Command{Name: "github", Help: "github", SubCommands: []command.Command{{
+		Name:  "login",
+		Help:  "login",
+		Args:  []command.Arg{{Name: "token", Required: true}},
+		Flags: []command.Flag{{Name: "scope", Value: "scope"}, {Name: "force"}},
+		Handler: func(ctx context.Context, args []string) error {
+			if len(args) > 0 && args[len(args)-1] == "bad" {
+				return errors.New("bad token")
+			}
+			fmt.Fprintln(cli.Output(ctx), strings.Join(args, " "))
+			return nil
+		},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	printed := false
+	if err := c.AddCommand(command.Command{Name: "hello", Help: "hello", Func: func(args []string) { printed = true }}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddCommand(command.Command{Name: "list", Help: "list", Out: func(w io.Writer, args []string) {
+		fmt.Fprintln(w, "listed")
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go c.Serve(context.Background(), l)
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	dec := json.NewDecoder(conn)
+
+	call := func(request string) map[string]interface{} {
+		t.Helper()
+		if _, err := io.WriteString(conn, request+"\n"); err != nil {
+			t.Fatal(err)
+		}
+		var reply map[string]interface{}
+		if err := dec.Decode(&reply); err != nil {
+			t.Fatal(err)
+		}
+		return reply
+	}
+
+	reply := call(`{"jsonrpc": "2.0", "id": 1, "method": "github.login", "params": {"token": "abc", "scope": ["repo", "gist"], "force": true}}`)
+	if out := reply["result"].(map[string]interface{})["output"]; out != "--scope=repo --scope=gist --force=true abc\n" {
+		t.Errorf("unexpected output %q", out)
+	}
+	reply = call(`{"jsonrpc": "2.0", "id": 2, "method": "github.login", "params": ["bad"]}`)
+	if e := reply["error"].(map[string]interface{}); e["message"] != "bad token" {
+		t.Errorf("unexpected error %v", e)
+	}
+	reply = call(`{"jsonrpc": "2.0", "id": 3, "method": "github.login", "params": {"scope": "repo"}}`)
+	if e := reply["error"].(map[string]interface{}); e["code"] != float64(-32602) {
+		t.Errorf("expected invalid params, got %v", e)
+	}
+	reply = call(`{"jsonrpc": "2.0", "id": 4, "method": "github.logout"}`)
+	if e := reply["error"].(map[string]interface{}); e["code"] != float64(-32601) {
+		t.Errorf("expected method not found, got %v", e)
+	}
+	reply = call(`{"jsonrpc": "2.0", "id": 5, "method": "hello"}`)
+	if e, ok := reply["error"].(map[string]interface{}); !ok || !strings.Contains(e["message"].(string), "Func") || printed {
+		t.Errorf("expected a Func command to be refused, got %v", reply)
+	}
+	reply = call(`{"jsonrpc": "2.0", "id": "list", "method": "rpc.list"}`)
+	if commands := reply["result"].([]interface{}); len(commands) != 4 || reply["id"] != "list" {
+		t.Errorf("unexpected list %v", reply)
+	}
+	reply = call(`{"jsonrpc": "2.0", "id": 6, "method": "list"}`)
+	if out := reply["result"].(map[string]interface{})["output"]; out != "listed\n" {
+		t.Errorf("a command named list was not called, got %v", reply)
+	}
+
+	// the methods of a command named rpc would be taken for built-ins
+	c.AddCommand(command.Command{Name: "rpc", Help: "rpc", Out: func(w io.Writer, args []string) {}})
+	if err := c.Serve(context.Background(), l); err == nil {
+		t.Error("expected Serve to refuse a command named rpc")
+	}
+}
+
+func TestFuncOutput(t *testing.T) {
+	c := cli.NewCli()
+	printed := 0
+	if err := c.AddCommand(command.Command{Name: "hello", Help: "hello", Func: func(args []string) { printed++ }}); err != nil {
+		t.Fatal(err)
+	}
+	// the process stdout is where a Func prints
+	hello, _ := c.Lookup("hello")
+	if err := hello.Run(context.Background(), nil); err != nil || printed != 1 {
+		t.Errorf("expected Func to run on the terminal, got %v", err)
+	}
+	s, err := c.NewSession(ioutil.NopCloser(strings.NewReader("")), ioutil.Discard, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Exec(context.Background(), "hello"); !errors.Is(err, command.ErrStdout) || printed != 1 {
+		t.Errorf("expected a remote session to refuse a Func command, got %v", err)
+	}
+}
+
+// echoCli returns a Cli with an echo command printing its args to its output
+func echoCli(t *testing.T) *cli.Cli {
+	c := cli.NewCli()
+	err := c.AddCommand(command.Command{Name: "echo", Help: "print args", Out: func(w io.Writer, args []string) {
+		fmt.Fprintln(w, strings.Join(args, " "))
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestSessionVars(t *testing.T) {
+	c := echoCli(t)
+	var out syncBuffer
+	s, err := c.NewSession(ioutil.NopCloser(strings.NewReader("")), &out, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := s.Exec(ctx, "set who world"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Exec(ctx, "echo $who ${who}! $nope ${nope} $ cost$5 a&b ${who"); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(out.String()); got != "world world! $nope ${nope} $ cost$5 a&b ${who" {
+		t.Errorf("unexpected expansion %q", got)
+	}
+
+	// only a word of its own runs the line in the background
+	out = syncBuffer{}
+	if err := s.Exec(ctx, "echo rock&roll&"); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(out.String()); got != "rock&roll&" {
+		t.Errorf("an arg ending with & started a job: %q", got)
+	}
+	if err := s.Exec(ctx, "echo later &"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Exec(ctx, "wait"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "[1] echo later") {
+		t.Errorf("expected a job, got %q", out.String())
+	}
+}
+
+func TestServeUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli-unix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: filepath.Join(dir, "sock"), Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	c := echoCli(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	served := make(chan error, 1)
+	go func() { served <- c.ServeUnix(ctx, l, cli.SameUser) }()
+	conn, err := net.Dial("unix", filepath.Join(dir, "sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "set who world\recho hello $who\rexit\r")
+	out, _ := ioutil.ReadAll(conn)
+	if !strings.Contains(string(out), "hello world\r\n") {
+		t.Errorf("unexpected session output %q", out)
+	}
+
+	// sessions have their own variables
+	other, err := net.Dial("unix", filepath.Join(dir, "sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	io.WriteString(other, "echo hello $who\rexit\r")
+	out, _ = ioutil.ReadAll(other)
+	if !strings.Contains(string(out), "hello $who\r\n") {
+		t.Errorf("variable leaked between sessions %q", out)
+	}
+
+	// cancelling ctx stops the server and ends the open sessions
+	open, err := net.Dial("unix", filepath.Join(dir, "sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer open.Close()
+	io.WriteString(open, "echo still here\r")
+	cancel()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("unexpected error stopping the server: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("server not stopped by its context")
+	}
+	open.SetReadDeadline(time.Now().Add(2 * time.Second))
+	// closed is EOF or a reset, depending on the unread input
+	if _, err := ioutil.ReadAll(open); err != nil {
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			t.Error("session not closed with the server")
+		}
+	}
+}
+
+func TestServeSSH(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli-ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	_, hostKey, _ := ed25519.GenerateKey(nil)
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, clientKey, _ := ed25519.GenerateKey(nil)
+	clientSigner, err := ssh.NewSignerFromKey(clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := filepath.Join(dir, "authorized_keys")
+	if err := ioutil.WriteFile(keys, append([]byte("# test key\n"), ssh.MarshalAuthorizedKey(clientSigner.PublicKey())...), 0600); err != nil {
+		t.Fatal(err)
+	}
+	callback, err := cli.AuthorizedKeys(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{PublicKeyCallback: callback}
+	config.AddHostKey(hostSigner)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	c := echoCli(t)
+	blocked, cancelled := make(chan struct{}), make(chan struct{})
+	c.AddCommand(command.Command{Name: "block", Help: "block", Handler: func(ctx context.Context, args []string) error {
+		close(blocked)
+		<-ctx.Done()
+		close(cancelled)
+		return ctx.Err()
+	}})
+	go c.ServeSSH(context.Background(), l, config)
+
+	client, err := ssh.Dial("tcp", l.Addr().String(), &ssh.ClientConfig{
+		User:            "test",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(clientSigner)},
+		HostKeyCallback: ssh.FixedHostKey(hostSigner.PublicKey()),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := session.Output("echo over ssh")
+	if err != nil || !strings.Contains(string(out), "over ssh\n") {
+		t.Errorf("unexpected exec output %q %v", out, err)
+	}
+	session.Close()
+
+	session, err = client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Run("missing"); err == nil {
+		t.Error("expected a failed exit status for an unknown command")
+	}
+	session.Close()
+
+	// closing the channel cancels the command running in it
+	session, err = client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Start("block"); err != nil {
+		t.Fatal(err)
+	}
+	<-blocked
+	session.Close()
+	select {
+	case <-cancelled:
+	case <-time.After(2 * time.Second):
+		t.Error("command not cancelled when its channel closed")
+	}
+
+	_, otherKey, _ := ed25519.GenerateKey(nil)
+	otherSigner, _ := ssh.NewSignerFromKey(otherKey)
+	_, err = ssh.Dial("tcp", l.Addr().String(), &ssh.ClientConfig{
+		User:            "test",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(otherSigner)},
+		HostKeyCallback: ssh.FixedHostKey(hostSigner.PublicKey()),
+	})
+	if err == nil {
+		t.Error("expected an unknown key to be refused")
+	}
+}
+
+func TestServeTools(t *testing.T) {
+	c := echoCli(t)
+	err := c.AddCommand(command.Command{Name: "vault", Help: "vault", SubCommands: []command.Command{
+		{Name: "delete", Help: "delete an entry", Dangerous: true, Args: []command.Arg{{Name: "entry", Required: true}}, Out: func(w io.Writer, args []string) {
+			fmt.Fprintln(w, "deleted", args[0])
+		}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requests := strings.Join([]string{
+		`{"jsonrpc": "2.0", "id": 1, "method": "initialize", "params": {}}`,
+		`{"jsonrpc": "2.0", "method": "notifications/initialized"}`,
+		`{"jsonrpc": "2.0", "id": 2, "method": "tools/list"}`,
+		`{"jsonrpc": "2.0", "id": 3, "method": "tools/call", "params": {"name": "echo", "arguments": ["hi"]}}`,
+		`{"jsonrpc": "2.0", "id": 4, "method": "tools/call", "params": {"name": "vault_delete", "arguments": {"entry": "x"}}}`,
+	}, "\n")
+	var out strings.Builder
+	if err := c.ServeTools(context.Background(), strings.NewReader(requests), &out); err != nil {
+		t.Fatal(err)
+	}
+	replies := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(replies) != 4 {
+		t.Fatalf("expected 4 replies, got:\n%s", out.String())
+	}
+	if !strings.Contains(replies[0], `"protocolVersion"`) {
+		t.Errorf("unexpected initialize reply %s", replies[0])
+	}
+	if !strings.Contains(replies[1], `"name":"echo"`) || strings.Contains(replies[1], "vault_delete") {
+		t.Errorf("unexpected tools %s", replies[1])
+	}
+	if !strings.Contains(replies[2], `"text":"hi\n"`) {
+		t.Errorf("unexpected call result %s", replies[2])
+	}
+	if !strings.Contains(replies[3], `"error"`) {
+		t.Errorf("dangerous tool called without being allowed %s", replies[3])
+	}
+
+	out.Reset()
+	if err := c.ServeTools(context.Background(), strings.NewReader(requests), &out, "vault.delete"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "deleted x") {
+		t.Errorf("allowed dangerous tool not called:\n%s", out.String())
+	}
+
+	// subcommands of a dangerous command are dangerous, and colliding tool names are not offered
+	ran := func(w io.Writer, args []string) { fmt.Fprintln(w, "ran") }
+	for _, cmd := range []command.Command{
+		{Name: "admin", Help: "admin", Dangerous: true, SubCommands: []command.Command{{Name: "reset", Help: "reset", Out: ran}}},
+		{Name: "net", Help: "net", SubCommands: []command.Command{{Name: "up", Help: "up", Out: ran}}},
+		{Name: "net_up", Help: "net up", Out: ran},
+	} {
+		if err := c.AddCommand(cmd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	requests = strings.Join([]string{
+		`{"jsonrpc": "2.0", "id": 1, "method": "tools/list"}`,
+		`{"jsonrpc": "2.0", "id": 2, "method": "tools/call", "params": {"name": "admin_reset"}}`,
+		`{"jsonrpc": "2.0", "id": 3, "method": "tools/call", "params": {"name": "net_up"}}`,
+	}, "\n")
+	out.Reset()
+	if err := c.ServeTools(context.Background(), strings.NewReader(requests), &out); err != nil {
+		t.Fatal(err)
+	}
+	replies = strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(replies) != 3 {
+		t.Fatalf("expected 3 replies, got:\n%s", out.String())
+	}
+	if strings.Contains(replies[0], "admin_reset") || strings.Contains(replies[0], "net_up") {
+		t.Errorf("unexpected tools %s", replies[0])
+	}
+	if !strings.Contains(replies[1], `"error"`) {
+		t.Errorf("subcommand of a dangerous command called without being allowed %s", replies[1])
+	}
+	if !strings.Contains(replies[2], "ambiguous") {
+		t.Errorf("expected a colliding tool name to be refused %s", replies[2])
+	}
+
+	// a Func prints to os.Stdout, the protocol stream of the __tools mode
+	if err := c.AddCommand(command.Command{Name: "hello", Help: "hello", Func: func(args []string) {
+		fmt.Println("hello from Func")
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	err = c.ServeTools(context.Background(), strings.NewReader(strings.Join([]string{
+		`{"jsonrpc": "2.0", "id": 1, "method": "tools/list"}`,
+		`{"jsonrpc": "2.0", "id": 2, "method": "tools/call", "params": {"name": "hello"}}`,
+	}, "\n")), w)
+	os.Stdout = stdout
+	w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replies = strings.Split(strings.TrimSpace(string(stream)), "\n")
+	if len(replies) != 2 {
+		t.Fatalf("expected 2 replies, got:\n%s", stream)
+	}
+	for _, reply := range replies {
+		if !json.Valid([]byte(reply)) {
+			t.Errorf("invalid JSON-RPC message %q", reply)
+		}
+	}
+	if strings.Contains(replies[0], `"hello"`) || !strings.Contains(replies[1], `"error"`) {
+		t.Errorf("expected a Func command to be neither listed nor called:\n%s", stream)
+	}
+	out.Reset()
+	if err := c.ServeTools(context.Background(), strings.NewReader(requests), &out, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "admin_reset") || !strings.Contains(out.String(), `"text":"ran\n"`) {
+		t.Errorf("subcommand of an allowed dangerous command not offered:\n%s", out.String())
+	}
+}
+
+// TestConcurrentUse is meant to be run with the race detector, go test -race ./test
+func TestConcurrentUse(t *testing.T) {
+	c := echoCli(t)
+	if err := c.AddCommand(command.Command{Name: "github", Help: "github", SubCommands: []command.Command{
+		{Name: "login", Help: "login", Handler: func(ctx context.Context, args []string) error { return nil }},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "cli-concurrent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				name := fmt.Sprintf("cmd%d-%d", i, j)
+				if err := c.AddCommand(command.Command{Name: name, Help: name}); err != nil {
+					t.Error(err)
+					return
+				}
+				c.ReplaceCommand(command.Command{Name: "login", Help: name, Func: func(args []string) {}}, "github", "login")
+				if err := c.RemoveCommand(name); err != nil {
+					t.Error(err)
+					return
+				}
+				c.SetVault(nil)
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			docs := filepath.Join(dir, strconv.Itoa(i))
+			if err := os.Mkdir(docs, 0700); err != nil {
+				t.Error(err)
+				return
+			}
+			doc.GenMarkdownTree(c, docs)
+			doc.GenManTree(c, nil, docs)
+			for j := 0; j < 50; j++ {
+				doc.GenHTMLIndex(c, "concurrent", ioutil.Discard)
+				c.Complete([]string{"gi"})
+				c.Help(ioutil.Discard, "github", "login")
+				c.Invoke(context.Background(), "github.login", nil)
+				c.Schemas()
+				cli.Lint(c)
+				c.Idle()
+				c.GetVault()
+			}
+		}(i)
+	}
+	wg.Wait()
+	if len(c.Commands) != 2 {
+		t.Errorf("expected the 2 initial commands, got %d", len(c.Commands))
+	}
+}
+
+func TestRunLifecycle(t *testing.T) {
+	args := os.Args
+	defer func() { os.Args = args }()
+
+	c := echoCli(t)
+	var order []string
+	c.OnShutdown(func() error { order = append(order, "first"); return nil })
+	c.OnShutdown(func() error { order = append(order, "second"); return errors.New("hook failed") })
+
+	os.Args = []string{"prog", "unattended", "exit"}
+	if err := c.Run(context.Background()); err == nil || err.Error() != "hook failed" {
+		t.Errorf("expected the hook error, got %v", err)
+	}
+	if strings.Join(order, " ") != "second first" {
+		t.Errorf("unexpected hook order %q", order)
+	}
+
+	os.Args = []string{"prog", "unattended", "missing"}
+	if err := c.Run(context.Background()); err == nil {
+		t.Error("expected the error of the unattended command")
+	}
+
+	// a command stopping the Cli sees its context cancelled
+	stopped := make(chan struct{})
+	c.AddCommand(command.Command{Name: "stop", Help: "stop", Handler: func(ctx context.Context, args []string) error {
+		c.Stop()
+		<-ctx.Done()
+		close(stopped)
+		return nil
+	}})
+	os.Args = []string{"prog", "unattended", "stop"}
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-stopped:
+	default:
+		t.Error("Stop did not cancel the command context")
+	}
+}
+
+func TestTerminalHandOff(t *testing.T) {
+	args := os.Args
+	defer func() { os.Args = args }()
+	os.Args = []string{"prog"}
+	c, w := pipedCli(t)
+
+	ran := make(chan string, 4)
+	c.AddCommand(command.Command{Name: "edit", Help: "edit", Handler: func(ctx context.Context, args []string) error {
+		return c.WithTerminal(func() error {
+			ran <- "editor"
+			return errors.New("editor failed")
+		})
+	}})
+	c.AddCommand(command.Command{Name: "hold", Help: "hold", Handler: func(ctx context.Context, args []string) error {
+		c.Suspend()
+		ran <- "hold"
+		return nil
+	}})
+	c.AddCommand(command.Command{Name: "after", Help: "after", Handler: func(ctx context.Context, args []string) error {
+		ran <- "after"
+		return nil
+	}})
+	done := make(chan error, 1)
+	go func() { done <- c.Run(context.Background()) }()
+
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case got := <-ran:
+			if got != want {
+				t.Fatalf("expected %s, got %s", want, got)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s did not run", want)
+		}
+	}
+	fmt.Fprintln(w, "edit")
+	expect("editor")
+	fmt.Fprintln(w, "hold")
+	expect("hold")
+	fmt.Fprintln(w, "after")
+	select {
+	case got := <-ran:
+		t.Fatalf("%s ran while the REPL was suspended", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+	// the same loop picks up the pending line
+	c.Resume()
+	expect("after")
+
+	w.Close()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not return at the end of input")
+	}
+}
+
+func TestInterruptCommand(t *testing.T) {
+	args := os.Args
+	defer func() { os.Args = args }()
+	os.Args = []string{"prog"}
+	c, w := pipedCli(t)
+
+	ran := make(chan string, 4)
+	c.AddCommand(command.Command{Name: "block", Help: "block", Handler: func(ctx context.Context, args []string) error {
+		ran <- "block"
+		<-ctx.Done()
+		ran <- "interrupted"
+		return ctx.Err()
+	}})
+	c.AddCommand(command.Command{Name: "after", Help: "after", Handler: func(ctx context.Context, args []string) error {
+		ran <- "after"
+		return nil
+	}})
+	done := make(chan error, 1)
+	go func() { done <- c.Run(context.Background()) }()
+
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case got := <-ran:
+			if got != want {
+				t.Fatalf("expected %s, got %s", want, got)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s did not run", want)
+		}
+	}
+	fmt.Fprintln(w, "block")
+	expect("block")
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Signal(os.Interrupt); err != nil {
+		t.Skip("cannot send SIGINT:", err)
+	}
+	expect("interrupted")
+	// the REPL is still running
+	fmt.Fprintln(w, "after")
+	expect("after")
+
+	w.Close()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not return at the end of input")
+	}
+}
+
+func TestInterruptFunc(t *testing.T) {
+	// the test binary runs itself, the process exits on SIGINT
+	if hook := os.Getenv("CLI_TEST_INTERRUPT_FUNC"); hook != "" {
+		c := cli.NewCli()
+		c.AddCommand(command.Command{Name: "block", Help: "block", Func: func(args []string) {
+			fmt.Println("running")
+			select {}
+		}})
+		c.OnShutdown(func() error {
+			return ioutil.WriteFile(hook, nil, 0600)
+		})
+		os.Args = []string{"prog", "unattended", "block"}
+		c.Run(context.Background())
+		os.Exit(1)
+	}
+
+	dir, err := ioutil.TempDir("", "cli-interrupt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	hook := filepath.Join(dir, "hook")
+	cmd := exec.Command(os.Args[0], "-test.run=^TestInterruptFunc$")
+	cmd.Env = append(os.Environ(), "CLI_TEST_INTERRUPT_FUNC="+hook)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill()
+	line := make([]byte, len("running"))
+	if _, err := io.ReadFull(stdout, line); err != nil || string(line) != "running" {
+		t.Fatalf("the command did not run: %v %q", err, line)
+	}
+	if err := cmd.Process.Signal(os.Interrupt); err != nil {
+		t.Skip("cannot send SIGINT:", err)
+	}
+	// the pipe ends with the process
+	io.Copy(ioutil.Discard, stdout)
+	err = cmd.Wait()
+	if exit, ok := err.(*exec.ExitError); !ok || exit.ExitCode() != 130 {
+		t.Errorf("expected exit status 130, got %v", err)
+	}
+	if _, err := os.Stat(hook); err != nil {
+		t.Errorf("the shutdown hooks did not run: %v", err)
+	}
+}
+
+func TestToolsInterrupt(t *testing.T) {
+	args, stdin, stdout := os.Args, os.Stdin, os.Stdout
+	defer func() { os.Args, os.Stdin, os.Stdout = args, stdin, stdout }()
+	os.Args = []string{"prog", "__tools"}
+	in, requests, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	defer requests.Close()
+	replies, out, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replies.Close()
+	defer out.Close()
+	go io.Copy(ioutil.Discard, replies)
+	os.Stdin, os.Stdout = in, out
+
+	c := cli.NewCli()
+	ran := make(chan string, 2)
+	c.AddCommand(command.Command{Name: "block", Help: "block", Handler: func(ctx context.Context, args []string) error {
+		ran <- "block"
+		<-ctx.Done()
+		ran <- "interrupted"
+		return ctx.Err()
+	}})
+	done := make(chan error, 1)
+	go func() { done <- c.Run(context.Background()) }()
+	fmt.Fprintln(requests, `{"jsonrpc": "2.0", "id": 1, "method": "tools/call", "params": {"name": "block"}}`)
+	for _, want := range []string{"block", "interrupted"} {
+		select {
+		case got := <-ran:
+			if got != want {
+				t.Fatalf("expected %s, got %s", want, got)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s did not happen", want)
+		}
+		if want == "block" {
+			p, err := os.FindProcess(os.Getpid())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := p.Signal(os.Interrupt); err != nil {
+				t.Skip("cannot send SIGINT:", err)
+			}
+		}
+	}
+	// stdin is still open, the server stops reading it
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the tool server kept running after SIGINT")
+	}
+}
+
+// pipedCli returns a Cli whose REPL reads the lines written to w
+func pipedCli(t *testing.T) (*cli.Cli, *os.File) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	// the REPL reads the stdin it was created with
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = stdin }()
+	return cli.NewCli(), w
+}
+
+func TestIdleLock(t *testing.T) {
+	args := os.Args
+	defer func() { os.Args = args }()
+	os.Args = []string{"prog"}
+	c, w := pipedCli(t)
+
+	info := &vault.VaultInfo{MasterPassword: "secret"}
+	info.Unlocked.Store(true)
+	c.SetIdleTimeout(50*time.Millisecond, info)
+	ran := false
+	c.AddCommand(command.Command{Name: "after", Help: "after", Handler: func(ctx context.Context, args []string) error {
+		ran = true
+		return nil
+	}})
+	dir, err := ioutil.TempDir("", "cli-idle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	schedules := filepath.Join(dir, "schedules.json")
+	if err := c.SetScheduleFile(schedules); err != nil {
+		t.Fatal(err)
+	}
+	// new year's midnight is not reached while the REPL runs the schedules
+	os.Args = []string{"prog", "unattended", "schedule", "add", "0 0 1 1 *", "after"}
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	os.Args = []string{"prog"}
+	done := make(chan error, 1)
+	go func() { done <- c.Run(context.Background()) }()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !c.Locked() {
+		if time.Now().After(deadline) {
+			t.Fatal("the vault was not locked")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// the vault stays locked once the REPL has ended
+	w.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if info.MasterPassword != "" || info.Unlocked.Load() || c.GetVault() != nil {
+		t.Error("locking kept the master password or the database")
+	}
+
+	// remote sessions cannot prompt for the password, they run nothing until the vault is unlocked
+	in, end := io.Pipe()
+	defer end.Close()
+	var out strings.Builder
+	s, err := c.NewSession(in, &out, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Exec(context.Background(), "after"); err == nil || ran {
+		t.Error("a command ran while the vault was locked")
+	}
+	if err := s.Exec(context.Background(), "exit"); err == nil {
+		t.Error("expected exit to end the session")
+	}
+
+	// nor do JSON-RPC and tool calls or schedules
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go c.Serve(context.Background(), l)
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprintln(conn, `{"jsonrpc": "2.0", "id": 1, "method": "after"}`)
+	var reply map[string]interface{}
+	if err := json.NewDecoder(conn).Decode(&reply); err != nil || reply["error"] == nil || ran {
+		t.Errorf("a JSON-RPC call ran while the vault was locked: %v %v", err, reply)
+	}
+	var tools strings.Builder
+	err = c.ServeTools(context.Background(), strings.NewReader(`{"jsonrpc": "2.0", "id": 1, "method": "tools/call", "params": {"name": "after"}}`), &tools)
+	if err != nil || !strings.Contains(tools.String(), `"isError":true`) || ran {
+		t.Errorf("a tool call ran while the vault was locked: %v %s", err, tools.String())
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ticks := make(chan time.Time)
+	go c.RunSchedules(ctx, ticks)
+	ticks <- time.Date(2030, 1, 1, 0, 0, 0, 0, time.Local)
+	deadline = time.Now().Add(2 * time.Second)
+	for {
+		b, err := ioutil.ReadFile(schedules)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(b), "vault locked") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the scheduled run was not refused:\n%s", b)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if ran {
+		t.Error("a schedule ran while the vault was locked")
+	}
+}
+
+func TestIdleLockRunningCommand(t *testing.T) {
+	args := os.Args
+	defer func() { os.Args = args }()
+	os.Args = []string{"prog"}
+	c, w := pipedCli(t)
+
+	info := &vault.VaultInfo{MasterPassword: "secret"}
+	info.Unlocked.Store(true)
+	c.SetIdleTimeout(200*time.Millisecond, info)
+	lockedWhileRunning := make(chan bool, 1)
+	c.AddCommand(command.Command{Name: "long", Help: "long", Handler: func(ctx context.Context, args []string) error {
+		time.Sleep(500 * time.Millisecond)
+		lockedWhileRunning <- c.Locked()
+		return nil
+	}})
+	// read as soon as the REPL starts
+	fmt.Fprintln(w, "long")
+	done := make(chan error, 1)
+	go func() { done <- c.Run(context.Background()) }()
+
+	var finished time.Time
+	select {
+	case locked := <-lockedWhileRunning:
+		finished = time.Now()
+		if locked {
+			t.Error("the vault was locked under a running command")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the command did not run")
+	}
+	// the idle time counts from the end of the command
+	deadline := time.Now().Add(2 * time.Second)
+	for !c.Locked() {
+		if time.Now().After(deadline) {
+			t.Fatal("the vault was not locked after the command")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if since := time.Since(finished); since < 150*time.Millisecond {
+		t.Errorf("the vault was locked %s after the command returned", since)
+	}
+	w.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// syncBuffer is a buffer written by background jobs while the test reads it
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestBackgroundJobs(t *testing.T) {
+	c := cli.NewCli()
+	release := make(chan struct{})
+	c.AddCommand(command.Command{Name: "slow", Help: "slow", Handler: func(ctx context.Context, args []string) error {
+		select {
+		case <-release:
+			fmt.Fprintln(cli.Output(ctx), "slow output")
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}})
+	in, end := io.Pipe()
+	defer end.Close()
+	var out syncBuffer
+	s, err := c.NewSession(in, &out, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	exec := func(line string) error {
+		return s.Exec(ctx, line)
+	}
+
+	if err := exec("slow &"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "[1] slow") {
+		t.Errorf("expected the job number, got %q", out.String())
+	}
+	exec("jobs")
+	if !strings.Contains(out.String(), "Running") {
+		t.Errorf("expected a running job, got %q", out.String())
+	}
+	if strings.Contains(out.String(), "slow output") {
+		t.Error("the output of a background job was not buffered")
+	}
+	expect := func(want string) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for !strings.Contains(out.String(), want) {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %q, got %q", want, out.String())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// a finished job is reported with its output and forgotten
+	close(release)
+	if err := exec("wait"); err != nil {
+		t.Fatal(err)
+	}
+	expect("[1] Done\tslow\r\nslow output")
+	if err := exec("fg"); err == nil {
+		t.Error("expected fg to fail without jobs")
+	}
+
+	// fg shows the output of a running job
+	release = make(chan struct{})
+	exec("slow &")
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+	}()
+	if err := exec("fg 1"); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(out.String(), "slow output"); n != 2 {
+		t.Errorf("fg did not show the output of the job, got %q", out.String())
+	}
+	if err := exec("fg"); err == nil {
+		t.Error("expected fg to forget the job")
+	}
+
+	// killing cancels the context of the job
+	release = make(chan struct{})
+	exec("slow &")
+	if err := exec("kill 1"); err != nil {
+		t.Fatal(err)
+	}
+	exec("wait")
+	expect("Killed")
+	if err := exec("kill 1"); err == nil {
+		t.Error("expected a killed job to be forgotten")
+	}
+
+	// what a Func prints would not be in the output of the job
+	printed := false
+	c.AddCommand(command.Command{Name: "hello", Help: "hello", Func: func(args []string) { printed = true }})
+	if err := exec("hello &"); !errors.Is(err, command.ErrStdout) {
+		t.Errorf("expected a Func command to be refused in the background, got %v", err)
+	}
+	if err := exec("jobs"); err != nil || printed || strings.Contains(out.String(), "] hello") {
+		t.Errorf("a refused job was started: %v %q", err, out.String())
+	}
+}
+
+func TestNotify(t *testing.T) {
+	c := echoCli(t)
+	in, typed := io.Pipe()
+	var out syncBuffer
+	s, err := c.NewSession(in, &out, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- s.Run(context.Background()) }()
+
+	// once the session answered a line it is running and receives notifications
+	fmt.Fprint(typed, "echo ready\r")
+	waitFor := func(want string) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for !strings.Contains(out.String(), want) {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %q in %q", want, out.String())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitFor("ready")
+	c.Notify("backup finished")
+	c.NotifyLevel(cli.LevelError, "backup failed")
+	waitFor("backup finished")
+	waitFor("backup failed")
+
+	typed.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	noColor := color.NoColor
+	defer func() { color.NoColor = noColor }()
+	color.NoColor = false
+
+	c := cli.NewCli()
+	runs := 0
+	c.AddCommand(command.Command{Name: "counter", Help: "counter", Out: func(w io.Writer, args []string) {
+		runs++
+		fmt.Fprintln(w, "constant")
+		fmt.Fprintln(w, "run", runs)
+	}})
+	printed := false
+	c.AddCommand(command.Command{Name: "hello", Help: "hello", Func: func(args []string) { printed = true }})
+	in, end := io.Pipe()
+	defer end.Close()
+	s, err := c.NewSession(in, ioutil.Discard, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a remote session could not interrupt it
+	if err := s.Exec(context.Background(), "watch counter"); err == nil {
+		t.Error("expected watch to be refused in a remote session")
+	}
+
+	args := os.Args
+	defer func() { os.Args = args }()
+	for _, line := range []string{"watch", "watch -n 0 counter", "watch -n soon counter", "watch watch counter", "watch hello"} {
+		os.Args = append([]string{"prog", "unattended"}, strings.Fields(line)...)
+		if err := c.Run(context.Background()); err == nil {
+			t.Errorf("expected an error for %q", line)
+		}
+	}
+	if printed {
+		t.Error("watch ran a Func command")
+	}
+
+	var out syncBuffer
+	ctx, cancel := context.WithTimeout(command.WithOutput(context.Background(), &out), 350*time.Millisecond)
+	defer cancel()
+	os.Args = []string{"prog", "unattended", "watch", "-n", "0.1", "counter"}
+	if err := c.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if runs < 2 {
+		t.Fatalf("expected several runs, got %d", runs)
+	}
+	got := out.String()
+	for _, want := range []string{"Every 100ms: counter", "ok", "\x1b[7mrun 2"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in the output", want)
+		}
+	}
+	if strings.Contains(got, "\x1b[7mconstant") {
+		t.Error("an unchanged line was highlighted")
+	}
+}
+
+func TestParseCron(t *testing.T) {
+	at := func(s string) time.Time {
+		v, err := time.ParseInLocation("2006-01-02 15:04", s, time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	for _, tc := range []struct {
+		expr, from, next string
+	}{
+		{"*/15 * * * *", "2024-06-03 10:07", "2024-06-03 10:15"},
+		{"0 9 * * MON-FRI", "2024-06-01 12:00", "2024-06-03 09:00"},
+		{"30 2 1,15 * *", "2024-06-02 00:00", "2024-06-15 02:30"},
+		{"0 0 29 2 *", "2025-03-01 00:00", "2028-02-29 00:00"},
+		// both days restricted, either matches
+		{"0 0 1 * 7", "2024-06-01 00:00", "2024-06-02 00:00"},
+		{"@hourly", "2024-06-03 10:00", "2024-06-03 11:00"},
+		{"0 0 30 2 *", "2024-06-03 10:00", ""},
+	} {
+		c, err := cli.ParseCron(tc.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tc.expr, err)
+			continue
+		}
+		next := c.Next(at(tc.from))
+		if tc.next == "" {
+			if !next.IsZero() {
+				t.Errorf("%s: expected no next run, got %s", tc.expr, next)
+			}
+			continue
+		}
+		if !next.Equal(at(tc.next)) {
+			t.Errorf("%s from %s: expected %s, got %s", tc.expr, tc.from, tc.next, next.Format("2006-01-02 15:04"))
+		}
+		if !c.Matches(next) {
+			t.Errorf("%s does not match its next run %s", tc.expr, next)
+		}
+	}
+	for _, expr := range []string{"* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "* * * FOO *", "@often"} {
+		if _, err := cli.ParseCron(expr); err == nil {
+			t.Errorf("expected an error for %q", expr)
+		}
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	dir, err := ioutil.TempDir("", "schedule")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "schedules.json")
+
+	c := echoCli(t)
+	if err := c.SetScheduleFile(path); err != nil {
+		t.Fatal(err)
+	}
+	in, end := io.Pipe()
+	defer end.Close()
+	var out syncBuffer
+	s, err := c.NewSession(in, &out, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, line := range []string{`schedule add "*/5 * * * *" echo every five`, "schedule add @daily echo daily"} {
+		if err := s.Exec(ctx, line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, line := range []string{"schedule add * * * echo", `schedule add "61 * * * *" echo`, "schedule rm 9", "schedule nope"} {
+		if err := s.Exec(ctx, line); err == nil {
+			t.Errorf("expected an error for %q", line)
+		}
+	}
+
+	// a new Cli picks the schedules up from the file
+	other := echoCli(t)
+	if err := other.SetScheduleFile(path); err != nil {
+		t.Fatal(err)
+	}
+	var list strings.Builder
+	reloaded, err := other.NewSession(in, &list, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reloaded.Exec(ctx, "schedule list"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"*/5 * * * *", "echo every five", "@daily", "echo daily"} {
+		if !strings.Contains(list.String(), want) {
+			t.Errorf("expected %q in %q", want, list.String())
+		}
+	}
+
+	if err := s.Exec(ctx, "schedule rm 1"); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "every five") || !strings.Contains(string(b), "echo daily") {
+		t.Errorf("the schedule file was not updated: %s", b)
+	}
+
+	// due schedules run on every tick and their runs are recorded
+	for _, line := range []string{"schedule add 30 9 * * * echo morning", "schedule add 30 9 * * * missing"} {
+		if err := s.Exec(ctx, line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ticks := make(chan time.Time)
+	go c.RunSchedules(runCtx, ticks)
+	ticks <- time.Date(2024, 6, 3, 9, 30, 0, 0, time.Local)
+	history := func() string {
+		var h strings.Builder
+		hs, err := c.NewSession(in, &h, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := hs.Exec(ctx, "schedule history"); err != nil {
+			t.Fatal(err)
+		}
+		return h.String()
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for h := history(); !strings.Contains(h, "ok") || !strings.Contains(h, "unknown command"); h = history() {
+		if time.Now().After(deadline) {
+			t.Fatalf("the due schedules did not run: %q", h)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if h := history(); strings.Contains(h, "\n2 ") {
+		t.Errorf("a schedule ran at a time it is not due: %q", h)
+	}
+	b, err = ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"status": "ok"`) {
+		t.Errorf("the run was not saved: %s", b)
+	}
+
+	// a schedule that cannot be saved is not added
+	os.RemoveAll(dir)
+	if err := s.Exec(ctx, "schedule add @hourly echo lost"); err == nil {
+		t.Error("expected an error when the schedule file cannot be written")
+	}
+	list.Reset()
+	listing, err := c.NewSession(in, &list, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listing.Exec(ctx, "schedule list")
+	if strings.Contains(list.String(), "echo lost") {
+		t.Errorf("a schedule was kept after failing to save: %q", list.String())
+	}
+}
@@ -295,6 +295,34 @@ func CloseDB(db *gokeepasslib.Database, v *VaultInfo) error {
 	return nil
 }
 
+// LockDB forgets the master password and encrypts the protected entries of db, which may be nil
+func LockDB(db *gokeepasslib.Database, v *VaultInfo) error {
+	v.Unlocked.Store(false)
+	v.MasterPassword = ""
+	if db != nil {
+		if err := db.LockProtectedEntries(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnlockDB prompts for the master password and opens the database again
+func UnlockDB(v *VaultInfo) (*gokeepasslib.Database, error) {
+	password, err := DbUnlockPrompt()
+	if err != nil {
+		return nil, err
+	}
+	v.MasterPassword = password
+	db, err := OpenKeepassDatabase(v)
+	if err != nil {
+		v.MasterPassword = ""
+		return nil, err
+	}
+	v.Unlocked.Store(true)
+	return db, nil
+}
+
 func PromptDBPath() (string, error) {
 	pathPrompt := textinput.New("Path to vault database: ")
 	pathPrompt.Placeholder = "path cannot be empty"